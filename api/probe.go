@@ -0,0 +1,378 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primlock/zoomies/internal/logger"
+	"github.com/primlock/zoomies/internal/stats"
+)
+
+const (
+	ProbeICMP = "icmp"
+	ProbeTCP  = "tcp"
+	ProbeHTTP = "http"
+
+	// The time a single TCP connect or HTTP request may take before it is counted as lost.
+	ProbeReplyTimeout = 2 * time.Second
+
+	// The pause between the TCP connects or HTTP requests of a probe.
+	ProbeSampleInterval = 250 * time.Millisecond
+)
+
+var (
+	ErrAllProbesFailed = errors.New("every probe method failed")
+	ErrNoReply         = errors.New("no reply was received")
+)
+
+// Prober measures the round-trip time to a server. Library users can implement it to rank and
+// test servers with their own probes.
+type Prober interface {
+	// Method names how the round-trip times are measured, e.g. icmp.
+	Method() string
+
+	// Probe sends a count number of probes to the server and returns the replies. An error is
+	// returned when the probe could not be sent, no reply was received or the context ended.
+	Probe(ctx context.Context, server Server, count int) (*Samples, error)
+}
+
+// MethodRanker is implemented by probers that measure round-trip times with more than one method.
+// Round-trip times measured by different methods are not comparable, so servers are ranked by the
+// rank of their method first.
+type MethodRanker interface {
+	// Rank returns the preference of the method, where lower ranks are preferred.
+	Rank(method string) int
+}
+
+// Samples holds the round-trip times measured by a probe and the number of probes that got no reply.
+type Samples struct {
+	Method string          `json:"method"`
+	RTTs   []time.Duration `json:"rtts"`
+	Lost   int             `json:"lost"`
+}
+
+// Sent returns the number of probes sent.
+func (s *Samples) Sent() int {
+	return len(s.RTTs) + s.Lost
+}
+
+// Loss returns the percentage of probes that got no reply.
+func (s *Samples) Loss() float64 {
+	if s.Sent() == 0 {
+		return 0
+	}
+
+	return float64(s.Lost) / float64(s.Sent()) * 100
+}
+
+func (s *Samples) Min() time.Duration {
+	if len(s.RTTs) == 0 {
+		return 0
+	}
+
+	return slices.Min(s.RTTs)
+}
+
+func (s *Samples) Max() time.Duration {
+	if len(s.RTTs) == 0 {
+		return 0
+	}
+
+	return slices.Max(s.RTTs)
+}
+
+// Avg returns the mean of the round-trip times.
+func (s *Samples) Avg() time.Duration {
+	if len(s.RTTs) == 0 {
+		return 0
+	}
+
+	var total time.Duration
+	for _, rtt := range s.RTTs {
+		total += rtt
+	}
+
+	return total / time.Duration(len(s.RTTs))
+}
+
+// Median returns the middle of the round-trip times.
+func (s *Samples) Median() time.Duration {
+	if len(s.RTTs) == 0 {
+		return 0
+	}
+
+	values := make([]float64, len(s.RTTs))
+	for i, rtt := range s.RTTs {
+		values[i] = float64(rtt)
+	}
+
+	return time.Duration(stats.Median(values))
+}
+
+// StdDev returns the standard deviation of the round-trip times.
+func (s *Samples) StdDev() time.Duration {
+	if len(s.RTTs) == 0 {
+		return 0
+	}
+
+	avg := s.Avg()
+
+	var variance float64
+	for _, rtt := range s.RTTs {
+		variance += math.Pow(float64(rtt-avg), 2)
+	}
+
+	return time.Duration(math.Sqrt(variance / float64(len(s.RTTs))))
+}
+
+// Latency returns the samples as the result of a latency test.
+func (s *Samples) Latency() *LatencyResult {
+	return &LatencyResult{Ping: s.Avg(), Jitter: s.StdDev(), PacketLoss: s.Loss(), Method: s.Method}
+}
+
+// NewProber returns a Prober with the method that probes with the function. The method is set on
+// the samples the function returns.
+func NewProber(method string, fn func(ctx context.Context, server Server, count int) (*Samples, error)) Prober {
+	return &funcProber{method: method, fn: fn}
+}
+
+type funcProber struct {
+	method string
+	fn     func(ctx context.Context, server Server, count int) (*Samples, error)
+}
+
+func (p *funcProber) Method() string {
+	return p.method
+}
+
+func (p *funcProber) Probe(ctx context.Context, server Server, count int) (*Samples, error) {
+	samples, err := p.fn(ctx, server, count)
+	if err != nil {
+		return nil, err
+	}
+
+	samples.Method = p.method
+
+	return samples, nil
+}
+
+var (
+	// ICMPProbe pings the server. Raw sockets or unprivileged ICMP must be permitted on the host.
+	ICMPProbe = NewProber(ProbeICMP, probeICMP)
+
+	// TCPProbe times opening a TCP connection to the port of the server's url.
+	TCPProbe = NewProber(ProbeTCP, func(ctx context.Context, server Server, count int) (*Samples, error) {
+		return sampleRTTs(ctx, count, server.tcpRTT)
+	})
+
+	// HTTPProbe times receiving the headers of a response from the server's url.
+	HTTPProbe = NewProber(ProbeHTTP, func(ctx context.Context, server Server, count int) (*Samples, error) {
+		return sampleRTTs(ctx, count, server.httpRTT)
+	})
+)
+
+func probeICMP(ctx context.Context, server Server, count int) (*Samples, error) {
+	stats, err := server.icmpStatistics(ctx, count)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stats.Rtts) == 0 {
+		return nil, fmt.Errorf("error probing server %s: %w", server.Name, ErrNoReply)
+	}
+
+	return &Samples{RTTs: stats.Rtts, Lost: max(count-len(stats.Rtts), 0)}, nil
+}
+
+// ProbeChain probes a server with the first prober that works, falling back to the next prober
+// when one fails. A prober that fails because it is not permitted on this host, such as ICMP
+// without raw socket privileges, is skipped for the rest of the chain's life.
+type ProbeChain struct {
+	probers []Prober
+
+	mu          sync.Mutex
+	unavailable map[string]error
+}
+
+func NewProbeChain(probers ...Prober) *ProbeChain {
+	return &ProbeChain{probers: probers, unavailable: map[string]error{}}
+}
+
+// DefaultProbeChain returns a chain that tries ICMP, then a TCP connect and then an HTTP request.
+func DefaultProbeChain() *ProbeChain {
+	return NewProbeChain(ICMPProbe, TCPProbe, HTTPProbe)
+}
+
+// Method returns the methods of the chain in the order they are tried.
+func (c *ProbeChain) Method() string {
+	methods := make([]string, len(c.probers))
+	for i, p := range c.probers {
+		methods[i] = p.Method()
+	}
+
+	return strings.Join(methods, "/")
+}
+
+// Probe probes the server with each prober in turn and returns the samples of the first that
+// succeeds. Every sample of the set is measured with the same method.
+func (c *ProbeChain) Probe(ctx context.Context, server Server, count int) (*Samples, error) {
+	var errs []error
+	for _, p := range c.probers {
+		if err := c.isUnavailable(p.Method()); err != nil {
+			continue
+		}
+
+		samples, err := p.Probe(ctx, server, count)
+		if err == nil {
+			return samples, nil
+		} else if ctx.Err() != nil {
+			return nil, err
+		}
+
+		if errors.Is(err, os.ErrPermission) {
+			c.markUnavailable(p.Method(), err)
+			logger.FromContext(ctx).Info("probe method is unavailable; falling back", "method", p.Method(), "error", err)
+		} else {
+			logger.FromContext(ctx).Debug("probe failed", "method", p.Method(), logger.KeyServer, server.Name, "error", err)
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", p.Method(), err))
+	}
+
+	if len(errs) == 0 {
+		return nil, ErrAllProbesFailed
+	}
+
+	return nil, fmt.Errorf("%w: %w", ErrAllProbesFailed, errors.Join(errs...))
+}
+
+// Rank returns the position of the method in the chain, or the length of the chain when the chain
+// does not hold it. Round-trip times measured by earlier methods are preferred when ranking.
+func (c *ProbeChain) Rank(method string) int {
+	for i, p := range c.probers {
+		if p.Method() == method {
+			return i
+		}
+	}
+
+	return len(c.probers)
+}
+
+func (c *ProbeChain) isUnavailable(method string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.unavailable[method]
+}
+
+func (c *ProbeChain) markUnavailable(method string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.unavailable[method] = err
+}
+
+// tcpRTT returns the time taken to open a TCP connection to the port of the server's url.
+func (s Server) tcpRTT(ctx context.Context) (time.Duration, error) {
+	u, err := s.GetURL()
+	if err != nil {
+		return 0, err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	var d net.Dialer
+	start := time.Now()
+
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return 0, fmt.Errorf("error connecting to %s: %w", s.Name, err)
+	}
+
+	rtt := time.Since(start)
+	conn.Close()
+
+	return rtt, nil
+}
+
+// httpRTT returns the time taken to receive the headers of a response from the server's url.
+func (s Server) httpRTT(ctx context.Context) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error creating request for %s: %w", s.URL, err)
+	}
+
+	start := time.Now()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving response for %s: %w", s.URL, err)
+	}
+
+	rtt := time.Since(start)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, s.URL)
+	}
+
+	return rtt, nil
+}
+
+// sampleRTTs takes a count number of samples, each bounded by the reply timeout. Samples that fail
+// are counted as lost, and the error of the last one is returned when every sample fails.
+func sampleRTTs(ctx context.Context, count int, sample func(ctx context.Context) (time.Duration, error)) (*Samples, error) {
+	samples := &Samples{}
+	var last error
+
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(ProbeSampleInterval):
+			}
+		}
+
+		sampleCtx, cancel := context.WithTimeout(ctx, ProbeReplyTimeout)
+		rtt, err := sample(sampleCtx)
+		cancel()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			last = err
+			samples.Lost++
+			continue
+		}
+
+		samples.RTTs = append(samples.RTTs, rtt)
+	}
+
+	if len(samples.RTTs) == 0 {
+		if last == nil {
+			last = ErrNoReply
+		}
+
+		return nil, last
+	}
+
+	return samples, nil
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func mockProber(method string, err error) Prober {
+	return NewProber(method, func(ctx context.Context, server Server, count int) (*Samples, error) {
+		if err != nil {
+			return nil, err
+		}
+		return &Samples{RTTs: []time.Duration{time.Millisecond}}, nil
+	})
+}
+
+func TestProbeChain(t *testing.T) {
+	denied := &os.SyscallError{Syscall: "socket", Err: syscall.EACCES}
+
+	testCases := []struct {
+		name     string
+		icmp     error
+		tcp      error
+		method   string
+		expected error
+	}{
+		{name: "First method succeeds", method: ProbeICMP},
+		{name: "Falls back when there is no reply", icmp: ErrNoReply, method: ProbeTCP},
+		{name: "Falls back when permission is denied", icmp: denied, method: ProbeTCP},
+		{name: "Every method fails", icmp: denied, tcp: ErrNoReply, expected: ErrAllProbesFailed},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := NewProbeChain(mockProber(ProbeICMP, tt.icmp), mockProber(ProbeTCP, tt.tcp))
+
+			samples, err := chain.Probe(context.Background(), Server{Name: "test"}, 1)
+			if tt.expected != nil {
+				assert.ErrorIs(t, err, tt.expected)
+				assert.ErrorIs(t, err, tt.tcp)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.DeepEqual(t, samples.RTTs, []time.Duration{time.Millisecond})
+			assert.Equal(t, samples.Method, tt.method)
+		})
+	}
+}
+
+func TestProbeChainSkipsDeniedMethod(t *testing.T) {
+	calls := 0
+	icmp := NewProber(ProbeICMP, func(ctx context.Context, server Server, count int) (*Samples, error) {
+		calls++
+		return nil, &os.SyscallError{Syscall: "socket", Err: syscall.EPERM}
+	})
+
+	chain := NewProbeChain(icmp, mockProber(ProbeTCP, nil))
+	for i := 0; i < 3; i++ {
+		samples, err := chain.Probe(context.Background(), Server{Name: "test"}, 1)
+		assert.NilError(t, err)
+		assert.Equal(t, samples.Method, ProbeTCP)
+	}
+
+	assert.Equal(t, calls, 1)
+	assert.Equal(t, chain.Method(), "icmp/tcp")
+	assert.Equal(t, chain.Rank(ProbeTCP), 1)
+	assert.Equal(t, chain.Rank(ProbeHTTP), 2)
+}
+
+func TestTCPAndHTTPProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	s := Server{Name: "test", URL: srv.URL}
+
+	for _, p := range []Prober{TCPProbe, HTTPProbe} {
+		samples, err := p.Probe(context.Background(), s, 2)
+		assert.NilError(t, err)
+		assert.Equal(t, samples.Method, p.Method())
+		assert.Equal(t, len(samples.RTTs), 2)
+		assert.Equal(t, samples.Lost, 0)
+	}
+
+	srv.Close()
+
+	_, err := TCPProbe.Probe(context.Background(), s, 1)
+	assert.ErrorContains(t, err, "error connecting to test")
+}
+
+func TestSamples(t *testing.T) {
+	samples := &Samples{Method: ProbeTCP, RTTs: []time.Duration{30 * time.Millisecond, 10 * time.Millisecond}, Lost: 2}
+
+	assert.Equal(t, samples.Sent(), 4)
+	assert.Equal(t, samples.Min(), 10*time.Millisecond)
+	assert.Equal(t, samples.Max(), 30*time.Millisecond)
+	assert.Equal(t, samples.Median(), 20*time.Millisecond)
+	assert.DeepEqual(t, samples.Latency(), &LatencyResult{Ping: 20 * time.Millisecond, Jitter: 10 * time.Millisecond, PacketLoss: 50, Method: ProbeTCP})
+}
+
+func TestSampleRTTs(t *testing.T) {
+	replies := []time.Duration{10 * time.Millisecond, 0, 30 * time.Millisecond}
+	i := 0
+
+	samples, err := sampleRTTs(context.Background(), len(replies), func(ctx context.Context) (time.Duration, error) {
+		rtt := replies[i]
+		i++
+		if rtt == 0 {
+			return 0, ErrNoReply
+		}
+		return rtt, nil
+	})
+
+	assert.NilError(t, err)
+	assert.DeepEqual(t, samples.RTTs, []time.Duration{10 * time.Millisecond, 30 * time.Millisecond})
+	assert.Equal(t, samples.Lost, 1)
+
+	_, err = sampleRTTs(context.Background(), 1, func(ctx context.Context) (time.Duration, error) {
+		return 0, ErrNoReply
+	})
+	assert.ErrorIs(t, err, ErrNoReply)
+}
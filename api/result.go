@@ -0,0 +1,59 @@
+package api
+
+import "time"
+
+// Result holds the measurements gathered from a single run of the test suite.
+type Result struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Client    Client          `json:"client"`
+	Server    Server          `json:"server"`
+	Latency   *LatencyResult  `json:"latency,omitempty"`
+	Download  *TransferResult `json:"download,omitempty"`
+	Upload    *TransferResult `json:"upload,omitempty"`
+	Phases    []Phase         `json:"phases,omitempty"`
+	Retries   int             `json:"retries,omitempty"`
+}
+
+// Phase records when a stage of the run started and finished, and the error it failed with.
+type Phase struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Error string    `json:"error,omitempty"`
+}
+
+// LatencyResult holds the round-trip statistics measured by the latency test.
+type LatencyResult struct {
+	// The average round-trip time of the replies.
+	Ping time.Duration `json:"ping"`
+
+	// The standard deviation of the round-trip times.
+	Jitter time.Duration `json:"jitter"`
+
+	// The percentage of pings that received no reply.
+	PacketLoss float64 `json:"packet_loss"`
+
+	// The probe method the round-trip times were measured with: icmp, tcp or http.
+	Method string `json:"method,omitempty"`
+}
+
+// TransferResult holds the amount of data moved during a download or upload test.
+type TransferResult struct {
+	Bytes    uint64        `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+
+	// The round-trip times measured while the transfer ran, when they were measured.
+	LoadedLatency *LatencyResult `json:"loaded_latency,omitempty"`
+
+	// The requests that failed without ending the transfer.
+	Errors []string `json:"-"`
+}
+
+// BitsPerSecond returns the average rate of the transfer.
+func (t *TransferResult) BitsPerSecond() float64 {
+	if t.Duration <= 0 {
+		return 0
+	}
+
+	return float64(t.Bytes*8) / t.Duration.Seconds()
+}
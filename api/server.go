@@ -9,21 +9,82 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"os"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/primlock/zoomies/internal/logger"
 	probing "github.com/prometheus-community/pro-bing"
-	"github.com/pterm/pterm"
 )
 
 const (
 	FastSpeedTestServerURL = "https://api.fast.com/netflix/speedtest/v2"
 	FastBaseURL            = "https://fast.com"
+
+	// The time allowed for the last ICMP reply to arrive before it is counted as lost.
+	ICMPReplyTimeout = 2 * time.Second
+
+	// The time allowed for a request to the fast.com api to complete.
+	APIRequestTimeout = 10 * time.Second
+
+	// The time allowed to connect to a test server and receive the headers of its response. The
+	// body of a transfer is bounded by the test duration instead.
+	TransferConnectTimeout = 10 * time.Second
+
+	// How often the progress of a transfer is reported.
+	ProgressInterval = 200 * time.Millisecond
+
+	// The size of each range requested by a throughput pre-test.
+	PreTestChunkSize = 25 * 1024 * 1024
 )
 
-type ProbeFunc func(server Server, count int) (time.Duration, error)
+var ErrURLExpired = errors.New("the signed test server url expired")
+
+// TransferControl changes the number of concurrent requests of a running transfer or ends it early.
+// Its methods may be called from any goroutine.
+type TransferControl struct {
+	requests atomic.Int64
+	changed  chan struct{}
+	stop     chan struct{}
+	once     sync.Once
+}
+
+func NewTransferControl(requests int) *TransferControl {
+	c := &TransferControl{changed: make(chan struct{}, 1), stop: make(chan struct{})}
+	c.requests.Store(int64(max(requests, 1)))
+
+	return c
+}
+
+// Requests returns the number of concurrent requests the transfer keeps running.
+func (c *TransferControl) Requests() int {
+	return int(c.requests.Load())
+}
+
+// SetRequests changes the number of concurrent requests, which is at least one. Requests are
+// started right away when it grows, and finished requests are not replaced when it shrinks.
+func (c *TransferControl) SetRequests(n int) {
+	c.requests.Store(int64(max(n, 1)))
+
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Stop ends the transfer before its duration passes. The transfer returns what it measured so far.
+func (c *TransferControl) Stop() {
+	c.once.Do(func() { close(c.stop) })
+}
+
+// Progress is the state of a transfer passed to its progress function.
+type Progress struct {
+	// The bytes moved so far.
+	Bytes uint64
+
+	// The number of requests in flight.
+	Connections int
+}
 
 type Server struct {
 	Name          string `json:"name"`
@@ -36,264 +97,249 @@ type Server struct {
 }
 
 var (
-	CompletedPrinter = pterm.PrefixPrinter{
-		Prefix: pterm.Prefix{
-			Text: pterm.ThemeDefault.Checkmark.Checked,
+	// APIClient is used for the requests that discover the token and the test servers.
+	APIClient = &http.Client{Timeout: APIRequestTimeout}
+
+	// TransferClient is used for the download and upload requests.
+	TransferClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: TransferConnectTimeout}).DialContext,
+			TLSHandshakeTimeout:   TransferConnectTimeout,
+			ResponseHeaderTimeout: TransferConnectTimeout,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConnsPerHost:   64,
 		},
 	}
-
-	Spinner = pterm.SpinnerPrinter{
-		Sequence:            pterm.DefaultSpinner.Sequence,
-		Style:               &pterm.Style{pterm.FgGreen},
-		Delay:               pterm.DefaultSpinner.Delay,
-		ShowTimer:           false,
-		TimerRoundingFactor: time.Second,
-		TimerStyle:          &pterm.ThemeDefault.TimerStyle,
-		MessageStyle:        &pterm.ThemeDefault.SpinnerTextStyle,
-		InfoPrinter:         &CompletedPrinter,
-		Writer:              os.Stderr,
-	}
 )
 
-var log = logger.TLog
-
-func (s *Server) Download(requests int, chunk int64, duration time.Duration, useBinaryUnitPrefix bool) error {
-	var totalB uint64
-	ctx, cancel := context.WithTimeout(context.Background(), duration)
-	defer cancel()
-
+// Download reads from the server over the concurrent requests of the control until the duration
+// passes or the control stops it. The bytes read so far and the requests in flight are reported to
+// progress every ProgressInterval when it is not nil. An error is returned when the parent context
+// ends first or ErrURLExpired when the server rejects the signed url. Requests that fail without
+// ending the transfer are kept in the errors of the result.
+func (s *Server) Download(parent context.Context, ctl *TransferControl, duration time.Duration, progress func(p Progress)) (*TransferResult, error) {
 	// Create a default request for downloading the data
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.RangeBasedURL, nil)
+	req, err := http.NewRequest(http.MethodGet, s.RangeBasedURL, nil)
 	if err != nil {
-		return fmt.Errorf("failed to generate http request: %s", err)
+		return nil, fmt.Errorf("failed to generate http request: %s", err)
 	}
 
-	var logs []string
+	return transfer(parent, ctl, duration, progress, func(ctx context.Context) (uint64, error) {
+		resp, err := TransferClient.Do(req.Clone(ctx))
+		if err != nil {
+			return 0, fmt.Errorf("failed when making http request: %w", err)
+		}
+		defer resp.Body.Close()
 
-	// Create a channel for tracking downloads
-	downloadChannel := make(chan struct{}, requests)
+		if err := checkTransferStatus(resp); err != nil {
+			return 0, err
+		}
 
-	downloadData := func() {
-		clone := req.Clone(ctx)
+		// Record the data
+		n, err := io.Copy(io.Discard, resp.Body)
+		if err != nil {
+			return uint64(n), fmt.Errorf("failed to copy bytes: %w", err)
+		}
+
+		return uint64(n), nil
+	})
+}
 
-		// Send the request
-		resp, err := http.DefaultClient.Do(clone)
+// Upload writes the payload to the server over the concurrent requests of the control until the
+// duration passes or the control stops it, reporting progress like Download. An error is returned
+// when the parent context ends first or ErrURLExpired when the server rejects the signed url.
+func (s *Server) Upload(parent context.Context, ctl *TransferControl, duration time.Duration, payload []byte, progress func(p Progress)) (*TransferResult, error) {
+	return transfer(parent, ctl, duration, progress, func(ctx context.Context) (uint64, error) {
+		// Generate a request for the URL
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(payload))
 		if err != nil {
-			if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
-				logs = append(logs, fmt.Sprintf("failed when making http request: %s", err))
-			}
-		} else {
-			defer resp.Body.Close()
-
-			// Record the data
-			n, err := io.Copy(io.Discard, resp.Body)
-			if err != nil {
-				if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
-					logs = append(logs, fmt.Sprintf("failed to copy bytes: %s", err))
-				}
-			}
+			return 0, fmt.Errorf("failed to generate http request: %w", err)
+		}
 
-			atomic.AddUint64(&totalB, uint64(n))
+		resp, err := TransferClient.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("failed when making http request: %w", err)
+		}
+		defer resp.Body.Close()
 
-			// Signal the channel that the download finished
-			downloadChannel <- struct{}{}
+		if err := checkTransferStatus(resp); err != nil {
+			return 0, err
 		}
-	}
 
-	// Create a channel to update the display
-	displayChannel := make(chan bool)
+		return uint64(len(payload)), nil
+	})
+}
+
+// transfer keeps the concurrent requests of the control running until the duration passes, starting
+// a new request each time one finishes. The request returns the number of bytes it moved.
+func transfer(parent context.Context, ctl *TransferControl, duration time.Duration, progress func(p Progress), request func(ctx context.Context) (uint64, error)) (*TransferResult, error) {
+	var totalB atomic.Uint64
+	var active atomic.Int64
+	ctx, cancel := context.WithTimeout(parent, duration)
+	defer cancel()
 
-	ticker := time.NewTicker(200 * time.Millisecond)
+	var expired atomic.Bool
+
+	var mu sync.Mutex
+	var errs []string
+
+	// Create a channel for tracking finished requests and whether they succeeded
+	done := make(chan bool)
+
+	run := func() {
+		active.Add(1)
+		n, err := request(ctx)
+		active.Add(-1)
+		totalB.Add(n)
+
+		switch {
+		case errors.Is(err, ErrURLExpired):
+			// Every other request will be rejected too.
+			expired.Store(true)
+			cancel()
+		case err != nil && ctx.Err() == nil:
+			mu.Lock()
+			errs = append(errs, err.Error())
+			mu.Unlock()
+		}
 
-	spinner, err := Spinner.Start()
-	if err != nil {
-		return err
+		// Signal the channel that the request finished
+		select {
+		case done <- err == nil || n > 0:
+		case <-ctx.Done():
+		}
 	}
 
-	updateDisplay := func(start time.Time) {
-		for {
-			select {
-			case <-displayChannel:
-				return
-			case <-ticker.C:
-				speed := CurrentBitRate(totalB, start, useBinaryUnitPrefix)
-				spinner.UpdateText(pterm.Sprintf("Running the download test (%s)", speed))
-			}
+	running := 0
+	fill := func() {
+		for ; running < ctl.Requests(); running++ {
+			go run()
 		}
 	}
 
-	// Begin the concurrent downloads
+	ticker := time.NewTicker(ProgressInterval)
+	defer ticker.Stop()
+
+	// Begin the concurrent requests
 	start := time.Now()
-	for i := 0; i < requests; i++ {
-		go downloadData()
-	}
+	fill()
 
-	go updateDisplay(start)
+	result := func() *TransferResult {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return &TransferResult{Bytes: totalB.Load(), Duration: time.Since(start), Errors: slices.Clone(errs)}
+	}
 
-	// Main loop for orchastrating goroutines
+	// Main loop for orchestrating goroutines
 	for {
 		select {
 		case <-ctx.Done():
-			ticker.Stop()
-			displayChannel <- true
+			if err := parent.Err(); err != nil {
+				return nil, err
+			}
 
-			speed := CurrentBitRate(totalB, start, useBinaryUnitPrefix)
-			consumed := BytesConsumed(totalB, useBinaryUnitPrefix)
-			spinner.Info(pterm.Sprintf("Download speed: %s (%s)", speed, consumed))
+			if expired.Load() {
+				return nil, ErrURLExpired
+			}
 
-			// Report the logs collected while running
-			for _, l := range logs {
-				log.Error("%s\n", l)
+			return result(), nil
+		case <-ctl.stop:
+			if err := parent.Err(); err != nil {
+				return nil, err
 			}
 
-			return nil
-		case <-downloadChannel:
-			// Begin another download while not timed out
-			go downloadData()
+			if expired.Load() {
+				return nil, ErrURLExpired
+			}
+
+			return result(), nil
+		case <-ticker.C:
+			if progress != nil {
+				progress(Progress{Bytes: totalB.Load(), Connections: int(active.Load())})
+			}
+		case <-ctl.changed:
+			fill()
+		case ok := <-done:
+			// Begin another request while not timed out. A failed request is replaced only when
+			// the number of requests changes.
+			running--
+			if ok {
+				fill()
+			}
 		}
 	}
 }
 
-func (s *Server) Upload(requests int, duration time.Duration, payload []byte, useBinaryUnitPrefix bool) error {
-	var totalB uint64
-	ctx, cancel := context.WithTimeout(context.Background(), duration)
+// PreTest downloads from the server over a single request until the duration passes without
+// reporting progress, so that servers can be compared by throughput before the test.
+func (s *Server) PreTest(parent context.Context, duration time.Duration) (*TransferResult, error) {
+	ctx, cancel := context.WithTimeout(parent, duration)
 	defer cancel()
 
-	var logs []string
+	target := *s
+	if err := target.SetChunkSize(PreTestChunkSize); err != nil {
+		return nil, err
+	}
 
-	// Create a channel for tracking uploads
-	uploadChannel := make(chan struct{}, requests)
+	var totalB uint64
 
-	uploadData := func() {
-		// Generate a request for the URL
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(payload))
+	start := time.Now()
+	for ctx.Err() == nil {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.RangeBasedURL, nil)
 		if err != nil {
-			logs = append(logs, fmt.Sprintf("failed to generate http request: %s", err))
+			return nil, fmt.Errorf("failed to generate http request: %s", err)
 		}
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := TransferClient.Do(req)
 		if err != nil {
-			if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
-				logs = append(logs, fmt.Sprintf("failed when making http request: %s", err))
+			if ctx.Err() != nil {
+				break
 			}
-		} else {
-			defer resp.Body.Close()
-
-			atomic.AddUint64(&totalB, uint64(len(payload)))
 
-			// Signal the channel that the upload finished
-			uploadChannel <- struct{}{}
+			return nil, fmt.Errorf("failed when making http request: %w", err)
 		}
-	}
-
-	// Create a channel to update the display
-	displayChannel := make(chan bool)
-
-	ticker := time.NewTicker(200 * time.Millisecond)
-
-	spinner, err := Spinner.Start()
-	if err != nil {
-		return err
-	}
 
-	updateDisplay := func(start time.Time) {
-		for {
-			select {
-			case <-displayChannel:
-				return
-			case <-ticker.C:
-				speed := CurrentBitRate(totalB, start, useBinaryUnitPrefix)
-				spinner.UpdateText(pterm.Sprintf("Running the upload test (%s)", speed))
-			}
+		if err := checkTransferStatus(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
 		}
-	}
 
-	// Begin the upload goroutines
-	start := time.Now()
-	for i := 0; i < requests; i++ {
-		go uploadData()
+		n, _ := io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		totalB += uint64(n)
 	}
 
-	go updateDisplay(start)
-
-	// Main loop for orchastrating the downloads
-	for {
-		select {
-		case <-ctx.Done():
-			ticker.Stop()
-			displayChannel <- true
-
-			speed := CurrentBitRate(totalB, start, useBinaryUnitPrefix)
-			consumed := BytesConsumed(totalB, useBinaryUnitPrefix)
-			spinner.Info(pterm.Sprintf("Upload speed: %s (%s)", speed, consumed))
-
-			// Report the logs collected while running
-			for _, l := range logs {
-				log.Error("%s\n", l)
-			}
-
-			return nil
-		case <-uploadChannel:
-			// Begin another upload while not timed out
-			go uploadData()
-		}
+	if err := parent.Err(); err != nil {
+		return nil, err
 	}
-}
 
-func (s *Server) Latency(count int) error {
-	// Create a channel for updating the display
-	displayChannel := make(chan bool)
-
-	ticker := time.NewTicker(400 * time.Millisecond)
+	return &TransferResult{Bytes: totalB, Duration: time.Since(start)}, nil
+}
 
-	spinner, err := Spinner.Start()
-	if err != nil {
-		return err
+// checkTransferStatus returns an error for a response that is not a success, or ErrURLExpired when
+// the server rejects the signed url.
+func checkTransferStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
 	}
 
-	dots := 0
-	updateDisplay := func() {
-		for {
-			select {
-			case <-displayChannel:
-				return
-			case <-ticker.C:
-				switch dots {
-				case 0:
-					spinner.UpdateText("Running the latency test      ")
-					dots++
-				case 1:
-					spinner.UpdateText("Running the latency test .    ")
-					dots++
-				case 2:
-					spinner.UpdateText("Running the latency test . .  ")
-					dots++
-				case 3:
-					spinner.UpdateText("Running the latency test . . .")
-					dots = 0
-				}
-			}
-		}
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusGone {
+		return fmt.Errorf("%w: status code %d for %s", ErrURLExpired, resp.StatusCode, resp.Request.URL.Host)
 	}
 
-	go updateDisplay()
+	return fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, resp.Request.URL.Host)
+}
 
-	rtt, err := s.ICMPProbe(count)
+// Latency measures the round-trip statistics of the server with the default probe chain.
+func (s *Server) Latency(ctx context.Context, count int) (*LatencyResult, error) {
+	samples, err := DefaultProbeChain().Probe(ctx, *s, count)
 	if err != nil {
-		ticker.Stop()
-		displayChannel <- true
-		return err
+		return nil, err
 	}
 
-	ticker.Stop()
-	displayChannel <- true
-
-	t := rtt.Round(time.Millisecond)
-
-	// Update the console with the results of the test
-	spinner.Info(pterm.Sprintf("Ping: %s", t))
-
-	return nil
+	return samples.Latency(), nil
 }
 
 func (s *Server) SetChunkSize(size int64) error {
@@ -332,63 +378,31 @@ func (s *Server) GetURL() (*url.URL, error) {
 	return u, nil
 }
 
-// Send a count number of ICMP pings to the server and return the average rtt.
-func (s *Server) ICMPProbe(count int) (time.Duration, error) {
+// icmpStatistics sends a count number of ICMP pings to the server and returns the statistics of
+// the replies. Pings that are not answered before the timeout are counted as lost, and an error is
+// returned when the context ends first.
+func (s *Server) icmpStatistics(ctx context.Context, count int) (*probing.Statistics, error) {
 	u, err := s.GetURL()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	pinger, err := probing.NewPinger(u.Hostname())
 	if err != nil {
-		return 0, fmt.Errorf("error creating pinger for %s: %w", s.Name, err)
+		return nil, fmt.Errorf("error creating pinger for %s: %w", s.Name, err)
 	}
 
 	pinger.Count = count
+	pinger.Timeout = time.Duration(count)*pinger.Interval + ICMPReplyTimeout
 
-	err = pinger.Run()
-	if err != nil {
-		return 0, fmt.Errorf("error probing server %s: %w", s.Name, err)
-	}
-
-	stats := pinger.Statistics()
-
-	return stats.AvgRtt, nil
-}
-
-func (s *Server) HTTPProbe(count int) (time.Duration, error) {
-	var rtt time.Duration
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	err = pinger.RunWithContext(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("error creating request for %s: %w", s.URL, err)
+		return nil, fmt.Errorf("error probing server %s: %w", s.Name, err)
 	}
 
-	for i := 0; i < count; i++ {
-		start := time.Now()
-
-		resp, err := client.Do(req)
-		if err != nil {
-			return 0, fmt.Errorf("error retrieving response for %s: %w", s.URL, err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return 0, fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, s.URL)
-		}
-
-		rtt += time.Since(start)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("error probing server %s: %w", s.Name, err)
 	}
 
-	avg := rtt / time.Duration(count)
-	return avg, nil
-}
-
-func ICMPProbe(server Server, count int) (time.Duration, error) {
-	return server.ICMPProbe(count)
-}
-
-func HTTPProbe(server Server, count int) (time.Duration, error) {
-	return server.HTTPProbe(count)
+	return pinger.Statistics(), nil
 }
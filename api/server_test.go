@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestTransferStatus(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		expected error
+		bytes    bool
+	}{
+		{name: "Successful transfer", status: http.StatusOK, bytes: true},
+		{name: "Expired signed url", status: http.StatusForbidden, expected: ErrURLExpired},
+		{name: "Server error is not counted", status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write(make([]byte, 1024))
+			}))
+			defer srv.Close()
+
+			s := Server{Name: "test", URL: srv.URL, RangeBasedURL: srv.URL}
+
+			var progress atomic.Uint64
+			download, err := s.Download(context.Background(), NewTransferControl(2), 300*time.Millisecond, func(p Progress) { progress.Store(p.Bytes) })
+			upload, uerr := s.Upload(context.Background(), NewTransferControl(2), 300*time.Millisecond, make([]byte, 1024), nil)
+
+			if tt.expected != nil {
+				assert.ErrorIs(t, err, tt.expected)
+				assert.ErrorIs(t, uerr, tt.expected)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.NilError(t, uerr)
+			assert.Equal(t, download.Bytes > 0, tt.bytes)
+			assert.Equal(t, upload.Bytes > 0, tt.bytes)
+			assert.Equal(t, progress.Load() > 0, tt.bytes)
+			assert.Equal(t, len(download.Errors) > 0, !tt.bytes)
+		})
+	}
+}
+
+func TestTransferParentCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	s := Server{Name: "test", URL: srv.URL, RangeBasedURL: srv.URL}
+
+	_, err := s.Download(ctx, NewTransferControl(1), time.Minute, nil)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTransferControl(t *testing.T) {
+	testCases := []struct {
+		name        string
+		requests    int
+		control     func(ctl *TransferControl)
+		connections int
+	}{
+		{name: "Requests added", requests: 1, control: func(ctl *TransferControl) { ctl.SetRequests(3) }, connections: 3},
+		{name: "Requests removed", requests: 3, control: func(ctl *TransferControl) { ctl.SetRequests(1) }, connections: 1},
+		{name: "At least one request", requests: 2, control: func(ctl *TransferControl) { ctl.SetRequests(0) }, connections: 1},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(20 * time.Millisecond)
+				w.Write(make([]byte, 1024))
+			}))
+			defer srv.Close()
+
+			s := Server{Name: "test", URL: srv.URL, RangeBasedURL: srv.URL}
+			ctl := NewTransferControl(tt.requests)
+
+			var connections atomic.Int64
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				tt.control(ctl)
+				time.Sleep(300 * time.Millisecond)
+				ctl.Stop()
+			}()
+
+			result, err := s.Download(context.Background(), ctl, time.Minute, func(p Progress) { connections.Store(int64(p.Connections)) })
+			assert.NilError(t, err)
+
+			// Stopping the transfer keeps what it measured.
+			assert.Assert(t, result.Bytes > 0)
+			assert.Assert(t, result.Duration < time.Minute)
+			assert.Equal(t, ctl.Requests(), tt.connections)
+			assert.Equal(t, int(connections.Load()), tt.connections)
+		})
+	}
+}
+
+func TestPreTest(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		expected error
+	}{
+		{name: "Successful pre-test", status: http.StatusOK},
+		{name: "Expired signed url", status: http.StatusForbidden, expected: ErrURLExpired},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write(make([]byte, 1024))
+			}))
+			defer srv.Close()
+
+			s := Server{Name: "test", URL: srv.URL}
+
+			result, err := s.PreTest(context.Background(), 100*time.Millisecond)
+			if tt.expected != nil {
+				assert.ErrorIs(t, err, tt.expected)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Assert(t, result.Bytes > 0)
+		})
+	}
+}
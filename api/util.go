@@ -1,13 +1,18 @@
 package api
 
 import (
+	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"golang.org/x/net/html"
 )
@@ -15,6 +20,7 @@ import (
 var (
 	ErrScriptSrcAttrNotFound = errors.New("no src attribute found within the script tag")
 	ErrTokenNotFound         = errors.New("token not found in provided string")
+	ErrInvalidBitRate        = errors.New("bit rate must be a number followed by a unit such as Mbps or Mibit/s")
 )
 
 const (
@@ -30,9 +36,9 @@ func GeneratePayload(size int) ([]byte, error) {
 	return payload, nil
 }
 
-func GetAPIEndpointToken() (string, error) {
+func GetAPIEndpointToken(ctx context.Context) (string, error) {
 	// Request for the HTML template where the .js script name lives.
-	resp, err := http.Get(FastBaseURL)
+	resp, err := Get(ctx, FastBaseURL)
 	if err != nil {
 		return "", err
 	}
@@ -47,10 +53,11 @@ func GetAPIEndpointToken() (string, error) {
 
 	// Make a request to the server for the .js file.
 	scriptURL := fmt.Sprintf("%s%s", FastBaseURL, script)
-	resp, err = http.Get(scriptURL)
+	resp, err = Get(ctx, scriptURL)
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -66,6 +73,17 @@ func GetAPIEndpointToken() (string, error) {
 	return token, nil
 }
 
+// Get requests the url with the api client, giving up when the context ends or the client times
+// out.
+func Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return APIClient.Do(req)
+}
+
 func getScriptName(r io.Reader) (string, error) {
 	doc, err := html.Parse(r)
 	if err != nil {
@@ -119,7 +137,11 @@ func BytesConsumed(B uint64, binary bool) string {
 
 // CurrentBitRate provides a human readable string that describes the rate of the data transfer.
 func CurrentBitRate(B uint64, start time.Time, binary bool) string {
-	bps := float64(B*8) / time.Since(start).Seconds()
+	return BitRate(float64(B*8)/time.Since(start).Seconds(), binary)
+}
+
+// BitRate provides a human readable string for a rate given in bits per second.
+func BitRate(bps float64, binary bool) string {
 	var base float64 = 1000
 	units := []string{"bps", "Kbps", "Mbps", "Gbps"}
 
@@ -136,3 +158,42 @@ func CurrentBitRate(B uint64, start time.Time, binary bool) string {
 
 	return fmt.Sprintf("%.2f %s", bps, units[i])
 }
+
+// ParseBitRate parses a rate written in the units used by BitRate, e.g. "100Mbps", "1.5 Gbps" or
+// "512 Kibit/s", and returns it in bits per second. A number without a unit is taken as bps.
+func ParseBitRate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+
+	val, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || val < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidBitRate, s)
+	}
+
+	unit := strings.TrimSpace(s[i:])
+	if unit == "" {
+		return val, nil
+	}
+
+	for _, u := range []struct {
+		units []string
+		base  float64
+	}{
+		{units: []string{"bps", "Kbps", "Mbps", "Gbps"}, base: 1000},
+		{units: []string{"bit/s", "Kibit/s", "Mibit/s", "Gibit/s"}, base: 1024},
+	} {
+		for power, name := range u.units {
+			if strings.EqualFold(unit, name) {
+				return val * math.Pow(u.base, float64(power)), nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %q", ErrInvalidBitRate, s)
+}
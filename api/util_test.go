@@ -197,3 +197,35 @@ func TestCurrentBitRate(t *testing.T) {
 		})
 	}
 }
+
+func TestParseBitRate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		s        string
+		expected float64
+		err      bool
+	}{
+		{name: "Decimal megabits", s: "100Mbps", expected: 100e6},
+		{name: "Space before the unit", s: "1.5 Gbps", expected: 1.5e9},
+		{name: "Lower case unit", s: "20mbps", expected: 20e6},
+		{name: "Binary kibibits", s: "512 Kibit/s", expected: 512 * 1024},
+		{name: "Binary mebibits", s: "1Mibit/s", expected: 1024 * 1024},
+		{name: "No unit", s: "2500", expected: 2500},
+		{name: "Round trips through BitRate", s: BitRate(20e6, false), expected: 20e6},
+		{name: "Unknown unit", s: "100MB/s", err: true},
+		{name: "No number", s: "Mbps", err: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBitRate(tt.s)
+			if tt.err {
+				assert.ErrorIs(t, err, ErrInvalidBitRate)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, got, tt.expected)
+		})
+	}
+}
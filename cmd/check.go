@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/check"
+	"github.com/pterm/pterm"
+)
+
+var (
+	ErrThresholdCheckFailed = errors.New("threshold check failed")
+	ErrInvalidLatency       = errors.New("latency must be a duration such as 30ms")
+	ErrInvalidLoss          = errors.New("loss must be a percentage in the range 0-100 such as 1%")
+	ErrUnknownThreshold     = errors.New("threshold must be one of download, upload, latency or loss")
+)
+
+// thresholdFlagNames maps each check to the flag that sets its threshold.
+var thresholdFlagNames = map[string]string{
+	check.Download: "min-download",
+	check.Upload:   "min-upload",
+	check.Latency:  "max-latency",
+	check.Loss:     "max-loss",
+}
+
+// checkExitCodes maps the failure of a single check to its exit code.
+var checkExitCodes = map[string]int{
+	check.Download: ExitDownload,
+	check.Upload:   ExitUpload,
+	check.Latency:  ExitLatency,
+	check.Loss:     ExitLoss,
+}
+
+// parseThresholds converts the threshold flags into thresholds, returning nil when none are set.
+func parseThresholds(params *Parameters) (*check.Thresholds, error) {
+	values := map[string]string{
+		check.Download: params.MinDownload,
+		check.Upload:   params.MinUpload,
+		check.Latency:  params.MaxLatency,
+		check.Loss:     params.MaxLoss,
+	}
+
+	return newThresholds(values, func(name string) string { return "--" + thresholdFlagNames[name] })
+}
+
+// parseThresholdMap converts a flag of name=value thresholds, e.g. download=100Mbps,loss=1%, into
+// thresholds, returning nil when it is empty.
+func parseThresholdMap(flag string, values map[string]string) (*check.Thresholds, error) {
+	for name := range values {
+		if _, ok := thresholdFlagNames[name]; !ok {
+			return nil, fmt.Errorf("--%s: %w: %q", flag, ErrUnknownThreshold, name)
+		}
+	}
+
+	return newThresholds(values, func(name string) string { return "--" + flag + " " + name })
+}
+
+// newThresholds parses the values keyed by check name. The label names the source of a value in
+// the errors returned.
+func newThresholds(values map[string]string, label func(name string) string) (*check.Thresholds, error) {
+	t := &check.Thresholds{}
+	set := false
+	var err error
+
+	if v := values[check.Download]; v != "" {
+		if t.MinDownload, err = api.ParseBitRate(v); err != nil {
+			return nil, fmt.Errorf("%s: %w", label(check.Download), err)
+		}
+
+		set = true
+	}
+
+	if v := values[check.Upload]; v != "" {
+		if t.MinUpload, err = api.ParseBitRate(v); err != nil {
+			return nil, fmt.Errorf("%s: %w", label(check.Upload), err)
+		}
+
+		set = true
+	}
+
+	if v := values[check.Latency]; v != "" {
+		if t.MaxLatency, err = time.ParseDuration(v); err != nil || t.MaxLatency <= 0 {
+			return nil, fmt.Errorf("%s: %w: %q", label(check.Latency), ErrInvalidLatency, v)
+		}
+
+		set = true
+	}
+
+	if v := values[check.Loss]; v != "" {
+		loss, err := parsePercent(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", label(check.Loss), err)
+		}
+
+		t.MaxLoss = &loss
+		set = true
+	}
+
+	if !set {
+		return nil, nil
+	}
+
+	return t, nil
+}
+
+// parsePercent parses a percentage with an optional % sign, e.g. "1%" or "0.5".
+func parsePercent(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || v < 0 || v > 100 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidLoss, s)
+	}
+
+	return v, nil
+}
+
+// checkThresholds evaluates the result against the thresholds, prints a pass/fail table and
+// returns an error carrying the exit code of the failed check.
+func checkThresholds(thresholds *check.Thresholds, result *api.Result, binary bool) error {
+	if thresholds == nil {
+		return nil
+	}
+
+	checks := thresholds.Evaluate(result)
+	if err := renderChecks(checks, binary); err != nil {
+		return err
+	}
+
+	failed := check.Failed(checks)
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return &ExitCodeError{
+			Code: checkExitCodes[failed[0].Name],
+			Err:  fmt.Errorf("%w: %s", ErrThresholdCheckFailed, failed[0].Name),
+		}
+	default:
+		names := make([]string, len(failed))
+		for i, c := range failed {
+			names[i] = c.Name
+		}
+
+		return &ExitCodeError{
+			Code: ExitMultiple,
+			Err:  fmt.Errorf("%w: %s", ErrThresholdCheckFailed, strings.Join(names, ", ")),
+		}
+	}
+}
+
+func renderChecks(checks []check.Check, binary bool) error {
+	data := pterm.TableData{{"Check", "Threshold", "Measured", "Result"}}
+	for _, c := range checks {
+		limit, value := formatCheckValue(c.Name, c.Limit, binary), formatCheckValue(c.Name, c.Value, binary)
+
+		switch c.Name {
+		case check.Download, check.Upload:
+			limit = "≥ " + limit
+		default:
+			limit = "≤ " + limit
+		}
+
+		if !c.Measured {
+			value = "not measured"
+		}
+
+		status := pterm.FgGreen.Sprint("PASS")
+		if !c.Passed {
+			status = pterm.FgRed.Sprint("FAIL")
+		}
+
+		data = append(data, []string{c.Name, limit, value, status})
+	}
+
+	pterm.DefaultBasicText.Println()
+	return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
+
+func formatCheckValue(name string, v float64, binary bool) string {
+	switch name {
+	case check.Latency:
+		return fmt.Sprintf("%.1f ms", v)
+	case check.Loss:
+		return fmt.Sprintf("%.1f%%", v)
+	default:
+		return api.BitRate(v, binary)
+	}
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"gotest.tools/v3/assert"
+)
+
+func TestInvalidThresholds(t *testing.T) {
+	testCases := []struct {
+		name     string
+		arg      string
+		expected error
+	}{
+		{name: "Download without a known unit", arg: "--min-download=100MB", expected: api.ErrInvalidBitRate},
+		{name: "Upload that is not a number", arg: "--min-upload=fast", expected: api.ErrInvalidBitRate},
+		{name: "Latency without a unit", arg: "--max-latency=30", expected: ErrInvalidLatency},
+		{name: "Loss above 100 percent", arg: "--max-loss=150%", expected: ErrInvalidLoss},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCmd()
+
+			c.SetOutput(&bytes.Buffer{})
+			c.SetArgs([]string{tt.arg})
+
+			got := c.Execute()
+
+			assert.ErrorIs(t, got, tt.expected)
+		})
+	}
+}
+
+func TestCheckThresholdsExitCode(t *testing.T) {
+	result := &api.Result{
+		Download: &api.TransferResult{Bytes: 125000000, Duration: 10 * time.Second},
+		Upload:   &api.TransferResult{Bytes: 25000000, Duration: 10 * time.Second},
+		Latency:  &api.LatencyResult{Ping: 25 * time.Millisecond, PacketLoss: 2},
+	}
+
+	testCases := []struct {
+		name     string
+		params   Parameters
+		expected int
+	}{
+		{name: "All checks pass", params: Parameters{MinDownload: "50Mbps", MinUpload: "10Mbps", MaxLatency: "30ms", MaxLoss: "5%"}, expected: ExitOK},
+		{name: "Download below the minimum", params: Parameters{MinDownload: "200Mbps"}, expected: ExitDownload},
+		{name: "Upload below the minimum", params: Parameters{MinUpload: "50Mbps"}, expected: ExitUpload},
+		{name: "Latency above the maximum", params: Parameters{MaxLatency: "20ms"}, expected: ExitLatency},
+		{name: "Loss above the maximum", params: Parameters{MaxLoss: "1%"}, expected: ExitLoss},
+		{name: "Several checks fail", params: Parameters{MinDownload: "200Mbps", MaxLoss: "0"}, expected: ExitMultiple},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			thresholds, err := parseThresholds(&tt.params)
+			assert.NilError(t, err)
+
+			err = checkThresholds(thresholds, result, false)
+
+			assert.Equal(t, ExitCode(err), tt.expected)
+			if tt.expected != ExitOK {
+				assert.ErrorIs(t, err, ErrThresholdCheckFailed)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "No error", err: nil, expected: ExitOK},
+		{name: "General error", err: errors.New("boom"), expected: ExitError},
+		{name: "Regression", err: fmt.Errorf("wrapped: %w", ErrRegressionDetected), expected: ExitRegression},
+		{name: "Joined with a check failure", err: errors.Join(ErrRegressionDetected, &ExitCodeError{Code: ExitLoss, Err: ErrThresholdCheckFailed}), expected: ExitLoss},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, ExitCode(tt.err), tt.expected)
+		})
+	}
+}
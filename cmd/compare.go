@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/compare"
+	"github.com/primlock/zoomies/internal/config"
+	"github.com/primlock/zoomies/internal/history"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrRegressionDetected  = errors.New("a regression beyond the tolerance was detected")
+	ErrToleranceOutOfRange = errors.New("tolerance must not be negative")
+)
+
+const (
+	CompareCommandName        = "compare"
+	CompareCommandDescription = "compare two results and flag regressions beyond a tolerance"
+)
+
+func newCompareCmd(params *Parameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   CompareCommandName + " <a> <b>",
+		Short: CompareCommandDescription,
+		Long: CompareCommandDescription + `.
+
+Each argument is either a JSON result written with --output json or the id of a result in the
+history. The second result is compared against the first and the command exits with an error
+when any metric is worse by more than the tolerance.`,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if params.Tolerance < 0 {
+				return ErrToleranceOutOfRange
+			}
+
+			a, err := loadResult(params, args[0])
+			if err != nil {
+				return err
+			}
+
+			b, err := loadResult(params, args[1])
+			if err != nil {
+				return err
+			}
+
+			deltas := compare.Compare(a, b, params.Tolerance)
+			if err := renderComparison(deltas, params.Config.BinaryUnitPrefix); err != nil {
+				return err
+			}
+
+			if compare.Regressed(deltas) {
+				return ErrRegressionDetected
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().Float64Var(&params.Tolerance, "tolerance", params.Tolerance, "the percentage a metric may get worse by before it is flagged as a regression")
+	cmd.Flags().BoolVarP(&params.Config.BinaryUnitPrefix, "binary", "b", params.Config.BinaryUnitPrefix, "display the unit prefixes in binary (Mibit/s) instead of decimal (Mbps)")
+	config.Mark(cmd.Flags(), "tolerance", "binary")
+
+	return cmd
+}
+
+// loadResult reads a result from a JSON file, falling back to the history when no file exists
+// with that name.
+func loadResult(params *Parameters, name string) (*api.Result, error) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		store, err := history.Open(params.HistoryFile)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := store.Get(name)
+		if errors.Is(err, history.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%s is neither a result file nor a history id", name)
+		} else if err != nil {
+			return nil, err
+		}
+
+		return &r.Result, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var result api.Result
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, fmt.Errorf("error parsing result %s: %w", name, err)
+	}
+
+	return &result, nil
+}
+
+// checkBaseline compares the result against the baseline, printing the comparison and returning
+// ErrRegressionDetected when a metric is worse than the tolerance allows.
+func checkBaseline(params *Parameters, baseline, result *api.Result) error {
+	if baseline == nil {
+		return nil
+	}
+
+	pterm.DefaultBasicText.Printf("\nCompared with the baseline from %s:\n", baseline.Timestamp.Local().Format(HistoryTimeFormat))
+
+	deltas := compare.Compare(baseline, result, params.Tolerance)
+	if err := renderComparison(deltas, params.Config.BinaryUnitPrefix); err != nil {
+		return err
+	}
+
+	if compare.Regressed(deltas) {
+		return ErrRegressionDetected
+	}
+
+	return nil
+}
+
+func renderComparison(deltas []compare.Delta, binary bool) error {
+	if len(deltas) == 0 {
+		pterm.DefaultBasicText.Println("No metrics were measured in both results")
+		return nil
+	}
+
+	data := pterm.TableData{{"Metric", "A", "B", "Change", ""}}
+	for _, d := range deltas {
+		format := func(v float64) string { return fmt.Sprintf("%.1f ms", v) }
+		switch {
+		case d.HigherIsBetter:
+			format = func(v float64) string { return api.BitRate(v, binary) }
+		case d.Metric == "loss":
+			format = func(v float64) string { return fmt.Sprintf("%.1f%%", v) }
+		}
+
+		status := pterm.FgGreen.Sprint(pterm.ThemeDefault.Checkmark.Checked)
+		if d.Regression {
+			status = pterm.FgRed.Sprint("regression")
+		}
+
+		change := fmt.Sprintf("%+.1f%%", d.Change)
+		if d.Baseline == 0 {
+			change = "n/a"
+		}
+
+		data = append(data, []string{d.Metric, format(d.Baseline), format(d.Current), change, status})
+	}
+
+	return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func writeResultFile(t *testing.T, name, body string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NilError(t, os.WriteFile(path, []byte(body), 0o644))
+	return path
+}
+
+func TestCompareCmd(t *testing.T) {
+	a := writeResultFile(t, "a.json", `{"latency":{"ping":20000000},"download":{"bytes":125000000,"duration":10000000000}}`)
+	b := writeResultFile(t, "b.json", `{"latency":{"ping":21000000},"download":{"bytes":100000000,"duration":10000000000}}`)
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected error
+	}{
+		{name: "Regression beyond the default tolerance", args: []string{a, b}, expected: ErrRegressionDetected},
+		{name: "Regression within a wider tolerance", args: []string{a, b, "--tolerance=25"}, expected: nil},
+		{name: "Improvement", args: []string{b, a}, expected: nil},
+		{name: "Negative tolerance", args: []string{a, b, "--tolerance=-1"}, expected: ErrToleranceOutOfRange},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCmd()
+
+			c.SetOutput(&bytes.Buffer{})
+			c.SetArgs(append([]string{CompareCommandName}, tt.args...))
+
+			got := c.Execute()
+
+			if tt.expected == nil {
+				assert.NilError(t, got)
+			} else {
+				assert.Error(t, got, tt.expected.Error())
+			}
+		})
+	}
+}
+
+func TestCompareMissingResult(t *testing.T) {
+	c := NewCmd()
+
+	c.SetOutput(&bytes.Buffer{})
+	c.SetArgs([]string{CompareCommandName, "missing-a", "missing-b", "--history-file=" + filepath.Join(t.TempDir(), "history.jsonl")})
+
+	got := c.Execute()
+
+	assert.Error(t, got, "missing-a is neither a result file nor a history id")
+}
+
+func TestUnknownOutputFormat(t *testing.T) {
+	c := NewCmd()
+
+	c.SetOutput(&bytes.Buffer{})
+	c.SetArgs([]string{"--output=xml"})
+
+	got := c.Execute()
+
+	assert.Error(t, got, ErrUnknownOutputFormat.Error())
+}
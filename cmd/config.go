@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/primlock/zoomies/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var ErrUnknownProfile = errors.New("unknown profile")
+
+const (
+	ConfigFlagName  = "config"
+	ProfileFlagName = "profile"
+)
+
+// builtinProfiles are the profiles available without a config file. A [profile.<name>] table in the
+// config file with the same name overrides their settings.
+var builtinProfiles = map[string]map[string]string{
+	"quick": {
+		"duration":    "5",
+		"pings":       "1",
+		"connections": "2",
+		"servers":     "3",
+	},
+	"thorough": {
+		"duration":    "30",
+		"pings":       "5",
+		"connections": "8",
+		"servers":     "10",
+		"timeout":     "180",
+	},
+}
+
+// loadConfig fills in the flags of the command that were not given on the command line from the
+// config file, the selected profile and the ZOOMIES_* environment variables. The precedence is
+// defaults < file < profile < env < flags.
+func loadConfig(cmd *cobra.Command, params *Parameters) error {
+	env := config.Environ(config.EnvPrefix, os.Environ())
+
+	path := params.ConfigFile
+	explicit := cmd.Flags().Changed(ConfigFlagName)
+	if v, ok := env[ConfigFlagName]; ok && !explicit {
+		path, explicit = v, true
+	}
+
+	file, err := config.Load(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		file = &config.File{}
+	} else if err != nil {
+		return fmt.Errorf("error loading config file: %w", err)
+	}
+
+	profile := file.Values[ProfileFlagName]
+	if v, ok := env[ProfileFlagName]; ok {
+		profile = v
+	}
+	if cmd.Flags().Changed(ProfileFlagName) {
+		profile = params.Profile
+	}
+
+	delete(file.Values, ProfileFlagName)
+	delete(env, ProfileFlagName)
+	delete(env, ConfigFlagName)
+
+	layers := []config.Layer{{Source: path, Values: file.Values}}
+	for name, values := range file.Profiles {
+		layers = append(layers, config.Layer{Source: path + " profile " + name, Values: values})
+	}
+
+	if err := config.Check(knownSettings(cmd.Root()), layers...); err != nil {
+		return err
+	}
+
+	if profile != "" {
+		values, err := profileSettings(file, profile)
+		if err != nil {
+			return err
+		}
+
+		layers = []config.Layer{layers[0], {Source: "profile " + profile, Values: values}}
+	} else {
+		layers = layers[:1]
+	}
+
+	layers = append(layers, config.Layer{Source: "environment", Values: env})
+
+	return config.Apply(cmd.Flags(), layers...)
+}
+
+// profileSettings returns the settings of the named profile, merging the file's table over the
+// built-in profile of the same name.
+func profileSettings(file *config.File, name string) (map[string]string, error) {
+	builtin, isBuiltin := builtinProfiles[name]
+	custom, isCustom := file.Profiles[name]
+	if !isBuiltin && !isCustom {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProfile, name)
+	}
+
+	values := map[string]string{}
+	for k, v := range builtin {
+		values[k] = v
+	}
+	for k, v := range custom {
+		values[k] = v
+	}
+
+	return values, nil
+}
+
+// knownSettings returns the names of the marked flags of the command and its subcommands, which
+// are the settings a config file may hold.
+func knownSettings(root *cobra.Command) map[string]bool {
+	known := map[string]bool{}
+
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		mark := func(f *pflag.Flag) {
+			if config.IsMarked(f) {
+				known[f.Name] = true
+			}
+		}
+
+		c.Flags().VisitAll(mark)
+		c.PersistentFlags().VisitAll(mark)
+
+		for _, sub := range c.Commands() {
+			walk(sub)
+		}
+	}
+	walk(root)
+
+	return known
+}
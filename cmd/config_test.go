@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/primlock/zoomies/internal/config"
+	"github.com/spf13/cobra"
+	"gotest.tools/v3/assert"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	testCases := []struct {
+		name        string
+		file        string
+		env         map[string]string
+		args        []string
+		duration    int
+		connections int
+		countries   []string
+	}{
+		{name: "Defaults", duration: DefaultDuration, connections: DefaultConcurrentRequests},
+		{name: "File", file: "duration = 10\nconnections = 4", duration: 10, connections: 4},
+		{name: "Built-in profile over the file", file: "duration = 10\nprofile = \"quick\"", duration: 5, connections: 2},
+		{name: "Profile table over the built-in profile", file: "profile = \"quick\"\n[profile.quick]\nduration = 7", duration: 7, connections: 2},
+		{name: "Environment over the profile", file: "duration = 10", env: map[string]string{"ZOOMIES_DURATION": "20"}, args: []string{"--profile=thorough"}, duration: 20, connections: 8},
+		{name: "Array", file: "country = [\"US\", \"CA\"]", duration: DefaultDuration, connections: DefaultConcurrentRequests, countries: []string{"US", "CA"}},
+		{name: "Flags over the environment", env: map[string]string{"ZOOMIES_DURATION": "20", "ZOOMIES_CONNECTIONS": "6"}, args: []string{"--duration=25"}, duration: 25, connections: 6},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if tt.file != "" {
+				assert.NilError(t, os.WriteFile(path, []byte(tt.file), 0o644))
+			}
+
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			params := NewParameters()
+			params.ConfigFile = path
+			c := newConfigTestCmd(params)
+			assert.NilError(t, c.ParseFlags(tt.args))
+
+			assert.NilError(t, loadConfig(c, params))
+
+			assert.Equal(t, params.Config.Duration, tt.duration)
+			assert.Equal(t, params.Config.ConcurrentRequests, tt.connections)
+			assert.DeepEqual(t, params.Selection.Countries, tt.countries)
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     string
+		args     []string
+		expected error
+	}{
+		{name: "Unknown setting", file: "speed = 10", expected: config.ErrUnknownSetting},
+		{name: "Unknown setting in a profile", file: "[profile.night]\nspeed = 10", expected: config.ErrUnknownSetting},
+		{name: "Unknown profile", args: []string{"--profile=night"}, expected: ErrUnknownProfile},
+		{name: "Invalid syntax", file: "duration", expected: config.ErrSyntax},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			assert.NilError(t, os.WriteFile(path, []byte(tt.file), 0o644))
+
+			params := NewParameters()
+			params.ConfigFile = path
+			c := newConfigTestCmd(params)
+			assert.NilError(t, c.ParseFlags(tt.args))
+
+			assert.ErrorIs(t, loadConfig(c, params), tt.expected)
+		})
+	}
+}
+
+func TestMissingConfigFile(t *testing.T) {
+	params := NewParameters()
+	c := newConfigTestCmd(params)
+	assert.NilError(t, c.ParseFlags([]string{"--config", filepath.Join(t.TempDir(), "missing.toml")}))
+
+	assert.ErrorIs(t, loadConfig(c, params), os.ErrNotExist)
+}
+
+func newConfigTestCmd(params *Parameters) *cobra.Command {
+	c := &cobra.Command{Use: CommandName}
+	addRunFlags(c.Flags(), params)
+	c.PersistentFlags().StringVar(&params.ConfigFile, ConfigFlagName, params.ConfigFile, "")
+	c.PersistentFlags().StringVar(&params.Profile, ProfileFlagName, "", "")
+
+	return c
+}
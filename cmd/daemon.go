@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/config"
+	"github.com/primlock/zoomies/internal/logger"
+	"github.com/primlock/zoomies/internal/schedule"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrIntervalOutOfBounds = errors.New("interval must be at least 1 minute")
+	ErrDaemonNagiosOutput  = errors.New("the daemon cannot print nagios output, run a single test instead")
+)
+
+const (
+	DaemonCommandName        = "daemon"
+	DaemonCommandDescription = "run the test suite repeatedly on a schedule"
+	DefaultDaemonInterval    = time.Hour
+	DefaultDaemonJitter      = 0
+	MinDaemonInterval        = time.Minute
+)
+
+type DaemonParameters struct {
+	// The time between the start of consecutive runs.
+	Interval time.Duration
+
+	// A cron expression that determines when runs start. Takes the place of the interval when set.
+	Cron string
+
+	// The upper bound of a random delay added before each run so that a fleet does not run at once.
+	Jitter time.Duration
+}
+
+func newDaemonCmd(params *Parameters) *cobra.Command {
+	daemon := &DaemonParameters{
+		Interval: DefaultDaemonInterval,
+		Jitter:   DefaultDaemonJitter,
+	}
+
+	cmd := &cobra.Command{
+		Use:   DaemonCommandName,
+		Short: DaemonCommandDescription,
+		Long: DaemonCommandDescription + `.
+
+With --interval the first run starts immediately and the next one starts an interval after it.
+With --cron each run starts at the next time matched by the expression. The results of every run
+are written to the configured sinks, and a failed run is logged without stopping the daemon.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+
+	addRunFlags(cmd.Flags(), params)
+
+	cmd.Flags().DurationVar(&daemon.Interval, "interval", daemon.Interval, "the time between the start of consecutive runs")
+	cmd.Flags().StringVar(&daemon.Cron, "cron", "", "a cron expression (e.g. \"*/30 * * * *\" or @hourly) that determines when runs start")
+	cmd.Flags().DurationVar(&daemon.Jitter, "jitter", daemon.Jitter, "the upper bound of a random delay added before each run")
+	config.Mark(cmd.Flags(), "interval", "cron", "jitter")
+	cmd.MarkFlagsMutuallyExclusive("interval", "cron")
+
+	cmd.RunE = daemonRunE(params, daemon)
+
+	return cmd
+}
+
+// daemonRunE runs the test suite on the schedule until the process is interrupted.
+func daemonRunE(params *Parameters, daemon *DaemonParameters) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		err := cmdValidateE(params)
+		if err != nil {
+			return err
+		}
+
+		if params.Output == OutputNagios {
+			return ErrDaemonNagiosOutput
+		}
+
+		if err := setupOutput(params); err != nil {
+			return err
+		}
+
+		sched, err := newSchedule(daemon)
+		if err != nil {
+			return err
+		}
+
+		thresholds, err := parseThresholds(params)
+		if err != nil {
+			return err
+		}
+
+		var baseline *api.Result
+		if params.Baseline != "" {
+			baseline, err = loadResult(params, params.Baseline)
+			if err != nil {
+				return err
+			}
+		}
+
+		sinks, err := newSinks(params, cmd.OutOrStdout())
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// Restore the default signal behaviour after the first signal so that a second one
+		// terminates a run that is still in progress.
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+
+		next := time.Now()
+		if daemon.Cron != "" {
+			next = sched.Next(next)
+		}
+
+		for run := 1; ; run++ {
+			wait := time.Until(next) + schedule.Jitter(daemon.Jitter)
+			runCtx := logger.With(cmd.Context(), "run", run)
+			log := logger.FromContext(runCtx)
+			log.Info("run scheduled", "at", time.Now().Add(wait).Format(time.RFC3339))
+
+			if !sleep(ctx, wait) {
+				log.Info("daemon stopped", "runs", run-1)
+				return nil
+			}
+
+			next = sched.Next(next)
+
+			result, err := runOnce(runCtx, params)
+			if err != nil {
+				log.Error("run failed", "error", err)
+			} else {
+				// The results of a run that finished after a signal are still written.
+				if err := writeSinks(runCtx, sinks, result); err != nil {
+					log.Error("failed to write the results", "error", err)
+				}
+
+				if err := writeOutput(cmd.OutOrStdout(), params, result); err != nil {
+					log.Error("failed to print the results", "error", err)
+				}
+
+				if err := checkBaseline(params, baseline, result); err != nil {
+					log.Error("the results regressed from the baseline", "error", err)
+				}
+
+				if err := checkThresholds(thresholds, result, params.Config.BinaryUnitPrefix); err != nil {
+					log.Error("the results failed a threshold", "error", err)
+				}
+			}
+
+			// Skip any activations that were missed while the run was in progress.
+			for now := time.Now(); next.Before(now); {
+				next = sched.Next(next)
+			}
+		}
+	}
+}
+
+// newSchedule creates the schedule described by the daemon parameters.
+func newSchedule(daemon *DaemonParameters) (schedule.Schedule, error) {
+	if daemon.Cron != "" {
+		return schedule.ParseCron(daemon.Cron)
+	}
+
+	if daemon.Interval < MinDaemonInterval {
+		return nil, ErrIntervalOutOfBounds
+	}
+
+	return schedule.Interval(daemon.Interval), nil
+}
+
+// sleep waits for the duration to elapse, returning false if the context is cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/primlock/zoomies/internal/schedule"
+	"gotest.tools/v3/assert"
+)
+
+func TestDaemonInvalidSchedule(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "Interval below the lower boundary", args: []string{"--interval=10s"}, expected: ErrIntervalOutOfBounds.Error()},
+		{name: "Malformed cron expression", args: []string{"--cron=* * *"}, expected: schedule.ErrCronFieldCount.Error()},
+		{name: "Interval and cron together", args: []string{"--interval=1h", "--cron=@hourly"}, expected: "if any flags in the group [interval cron] are set none of the others can be; [cron interval] were all set"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCmd()
+
+			c.SetOutput(&bytes.Buffer{})
+			c.SetArgs(append([]string{DaemonCommandName}, tt.args...))
+
+			got := c.Execute()
+
+			assert.Error(t, got, tt.expected)
+		})
+	}
+}
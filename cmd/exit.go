@@ -0,0 +1,48 @@
+package cmd
+
+import "errors"
+
+// Exit codes returned by the process. Errors that do not carry a code of their own exit with
+// ExitError.
+const (
+	ExitOK         = 0
+	ExitError      = 1
+	ExitRegression = 2
+	ExitDownload   = 3
+	ExitUpload     = 4
+	ExitLatency    = 5
+	ExitLoss       = 6
+	ExitMultiple   = 7
+)
+
+// ExitCodeError is an error that determines the exit code of the process.
+type ExitCodeError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitCodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitCodeError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code of the process for the error returned by the command.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	var e *ExitCodeError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+
+	if errors.Is(err, ErrRegressionDetected) {
+		return ExitRegression
+	}
+
+	return ExitError
+}
@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/config"
+	"github.com/primlock/zoomies/internal/history"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	ErrUnknownExportFormat = errors.New("export format must be one of csv or json")
+	ErrPruneNoCriteria     = errors.New("prune needs --older-than, --server or --isp, or --all to remove everything")
+	ErrInvalidTime         = errors.New("time must be a date (2006-01-02), an RFC 3339 timestamp or an age such as 7d or 12h")
+)
+
+const (
+	HistoryCommandName        = "history"
+	HistoryCommandDescription = "list, show, export and prune the results of previous runs"
+	HistoryTimeFormat         = "2006-01-02 15:04"
+	DefaultExportFormat       = "csv"
+)
+
+// HistoryFilter holds the flags that select records from the history.
+type HistoryFilter struct {
+	Since  string
+	Until  string
+	Server string
+	ISP    string
+	Limit  int
+}
+
+func newHistoryCmd(params *Parameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          HistoryCommandName,
+		Short:        HistoryCommandDescription,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+
+	cmd.AddCommand(
+		newHistoryListCmd(params),
+		newHistoryShowCmd(params),
+		newHistoryExportCmd(params),
+		newHistoryPruneCmd(params),
+	)
+
+	return cmd
+}
+
+func newHistoryListCmd(params *Parameters) *cobra.Command {
+	filter := &HistoryFilter{}
+
+	cmd := &cobra.Command{
+		Use:          "list",
+		Short:        "list the results of previous runs",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			records, err := listHistory(params, filter)
+			if err != nil {
+				return err
+			}
+
+			if len(records) == 0 {
+				pterm.DefaultBasicText.Println("No results found")
+				return nil
+			}
+
+			data := pterm.TableData{{"ID", "Time", "Server", "ISP", "Ping", "Download", "Upload"}}
+			for _, r := range records {
+				data = append(data, []string{
+					r.ID,
+					r.Timestamp.Local().Format(HistoryTimeFormat),
+					serverLocation(r.Server),
+					r.Client.ISP,
+					formatLatency(r.Latency),
+					formatTransfer(r.Download, params.Config.BinaryUnitPrefix),
+					formatTransfer(r.Upload, params.Config.BinaryUnitPrefix),
+				})
+			}
+
+			return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+		},
+	}
+
+	addHistoryFilterFlags(cmd.Flags(), filter)
+	cmd.Flags().BoolVarP(&params.Config.BinaryUnitPrefix, "binary", "b", params.Config.BinaryUnitPrefix, "display the unit prefixes in binary (Mibit/s) instead of decimal (Mbps)")
+	config.Mark(cmd.Flags(), "binary")
+
+	return cmd
+}
+
+func newHistoryShowCmd(params *Parameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "show <id>",
+		Short:        "show the details of a previous run",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := history.Open(params.HistoryFile)
+			if err != nil {
+				return err
+			}
+
+			r, err := store.Get(args[0])
+			if err != nil {
+				return err
+			}
+
+			binary := params.Config.BinaryUnitPrefix
+			data := pterm.TableData{
+				{"ID", r.ID},
+				{"Time", r.Timestamp.Local().Format(time.RFC3339)},
+				{"Origin", fmt.Sprintf("%s — %s, %s [%s]", r.Client.ISP, r.Client.Location.City, r.Client.Location.Country, r.Client.IP)},
+				{"Server", serverLocation(r.Server)},
+				{"URL", r.Server.URL},
+				{"Ping", formatLatency(r.Latency)},
+				{"Download", formatTransfer(r.Download, binary)},
+				{"Upload", formatTransfer(r.Upload, binary)},
+			}
+
+			if r.Download != nil {
+				data = append(data, []string{"Downloaded", api.BytesConsumed(r.Download.Bytes, binary)})
+			}
+
+			if r.Upload != nil {
+				data = append(data, []string{"Uploaded", api.BytesConsumed(r.Upload.Bytes, binary)})
+			}
+
+			if r.Latency != nil && r.Latency.Method != "" {
+				data = append(data, []string{"Ping method", r.Latency.Method})
+			}
+
+			if r.Retries > 0 {
+				data = append(data, []string{"Retries", fmt.Sprint(r.Retries)})
+			}
+
+			for _, p := range r.Phases {
+				status := p.End.Sub(p.Start).Round(time.Millisecond).String()
+				if p.Error != "" {
+					status += " (" + p.Error + ")"
+				}
+
+				data = append(data, []string{"Phase " + p.Name, status})
+			}
+
+			return pterm.DefaultTable.WithData(data).Render()
+		},
+	}
+
+	cmd.Flags().BoolVarP(&params.Config.BinaryUnitPrefix, "binary", "b", params.Config.BinaryUnitPrefix, "display the unit prefixes in binary (Mibit/s) instead of decimal (Mbps)")
+	config.Mark(cmd.Flags(), "binary")
+
+	return cmd
+}
+
+func newHistoryExportCmd(params *Parameters) *cobra.Command {
+	filter := &HistoryFilter{}
+	var format, output string
+
+	cmd := &cobra.Command{
+		Use:          "export",
+		Short:        "export the results of previous runs as csv or json",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var write func(io.Writer, []history.Record) error
+			switch format {
+			case "csv":
+				write = history.WriteCSV
+			case "json":
+				write = history.WriteJSON
+			default:
+				return ErrUnknownExportFormat
+			}
+
+			records, err := listHistory(params, filter)
+			if err != nil {
+				return err
+			}
+
+			if output == "" || output == "-" {
+				return write(cmd.OutOrStdout(), records)
+			}
+
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+
+			if err := write(f, records); err != nil {
+				f.Close()
+				return err
+			}
+
+			return f.Close()
+		},
+	}
+
+	addHistoryFilterFlags(cmd.Flags(), filter)
+	cmd.Flags().StringVarP(&format, "format", "f", DefaultExportFormat, "the export format (csv or json)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "the file to write the export to (default stdout)")
+
+	return cmd
+}
+
+func newHistoryPruneCmd(params *Parameters) *cobra.Command {
+	filter := &HistoryFilter{}
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:          "prune",
+		Short:        "remove the results of previous runs",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !all && filter.Until == "" && filter.Server == "" && filter.ISP == "" {
+				return ErrPruneNoCriteria
+			}
+
+			f, err := filter.toFilter()
+			if err != nil {
+				return err
+			}
+
+			store, err := history.Open(params.HistoryFile)
+			if err != nil {
+				return err
+			}
+
+			n, err := store.Prune(f)
+			if err != nil {
+				return err
+			}
+
+			pterm.DefaultBasicText.Printf("Removed %d results from the history\n", n)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&filter.Until, "older-than", "", "remove results older than a date or an age (e.g. 2024-01-31 or 90d)")
+	cmd.Flags().StringVar(&filter.Server, "server", "", "remove results from servers whose name, city or country contains this string")
+	cmd.Flags().StringVar(&filter.ISP, "isp", "", "remove results from an isp containing this string")
+	cmd.Flags().BoolVar(&all, "all", false, "remove every result")
+
+	return cmd
+}
+
+func addHistoryFilterFlags(fs *pflag.FlagSet, filter *HistoryFilter) {
+	fs.StringVar(&filter.Since, "since", "", "only results at or after a date or an age (e.g. 2024-01-31 or 7d)")
+	fs.StringVar(&filter.Until, "until", "", "only results before a date or an age (e.g. 2024-02-01 or 1d)")
+	fs.StringVar(&filter.Server, "server", "", "only results from servers whose name, city or country contains this string")
+	fs.StringVar(&filter.ISP, "isp", "", "only results from an isp containing this string")
+	fs.IntVarP(&filter.Limit, "limit", "n", 0, "only the most recent results up to this count")
+}
+
+// listHistory opens the history store and returns the records selected by the filter flags.
+func listHistory(params *Parameters, filter *HistoryFilter) ([]history.Record, error) {
+	f, err := filter.toFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := history.Open(params.HistoryFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.List(f)
+}
+
+func (h *HistoryFilter) toFilter() (history.Filter, error) {
+	since, err := parseTime(h.Since, time.Now())
+	if err != nil {
+		return history.Filter{}, err
+	}
+
+	until, err := parseTime(h.Until, time.Now())
+	if err != nil {
+		return history.Filter{}, err
+	}
+
+	return history.Filter{Since: since, Until: until, Server: h.Server, ISP: h.ISP, Limit: h.Limit}, nil
+}
+
+// parseTime parses a date, an RFC 3339 timestamp or an age relative to now such as 7d or 12h. An
+// empty string returns the zero time.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidTime, s)
+}
+
+func formatLatency(l *api.LatencyResult) string {
+	if l == nil {
+		return "-"
+	}
+
+	return l.Ping.Round(time.Millisecond).String()
+}
+
+func formatTransfer(t *api.TransferResult, binary bool) string {
+	if t == nil {
+		return "-"
+	}
+
+	return api.BitRate(t.BitsPerSecond(), binary)
+}
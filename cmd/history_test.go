@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/history"
+	"github.com/pterm/pterm"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		s        string
+		expected time.Time
+		err      bool
+	}{
+		{name: "Empty", s: "", expected: time.Time{}},
+		{name: "Date", s: "2024-03-01", expected: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.Local)},
+		{name: "RFC 3339", s: "2024-03-01T08:30:00Z", expected: time.Date(2024, time.March, 1, 8, 30, 0, 0, time.UTC)},
+		{name: "Age in days", s: "7d", expected: now.AddDate(0, 0, -7)},
+		{name: "Age as a duration", s: "36h", expected: now.Add(-36 * time.Hour)},
+		{name: "Invalid", s: "last tuesday", err: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTime(tt.s, now)
+			if tt.err {
+				assert.ErrorIs(t, err, ErrInvalidTime)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Assert(t, got.Equal(tt.expected), "got %s, want %s", got, tt.expected)
+		})
+	}
+}
+
+func TestHistoryExport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store := history.NewJSONL(path)
+
+	for _, city := range []string{"London", "Paris"} {
+		r := &api.Result{Timestamp: time.Now()}
+		r.Server.Location.City = city
+		assert.NilError(t, store.Write(context.Background(), r))
+	}
+
+	c := NewCmd()
+
+	var out bytes.Buffer
+	c.SetOut(&out)
+	c.SetArgs([]string{HistoryCommandName, "export", "--format=json", "--server=paris", "--history-file=" + path})
+
+	assert.NilError(t, c.Execute())
+
+	var records []history.Record
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &records))
+	assert.Equal(t, len(records), 1)
+	assert.Equal(t, records[0].Server.Location.City, "Paris")
+}
+
+func TestHistoryListWithoutLocation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store := history.NewJSONL(path)
+
+	r := &api.Result{Timestamp: time.Now(), Server: api.Server{Name: "speed.example.net", URL: "https://speed.example.net/file"}}
+	assert.NilError(t, store.Write(context.Background(), r))
+
+	var out bytes.Buffer
+	pterm.SetDefaultOutput(&out)
+	t.Cleanup(func() { pterm.SetDefaultOutput(os.Stdout) })
+
+	c := NewCmd()
+	c.SetOut(&bytes.Buffer{})
+	c.SetArgs([]string{HistoryCommandName, "list", "--history-file=" + path})
+
+	assert.NilError(t, c.Execute())
+
+	got := pterm.RemoveColorFromString(out.String())
+	assert.Assert(t, strings.Contains(got, "speed.example.net"), got)
+	assert.Assert(t, !strings.Contains(got, " , "), got)
+}
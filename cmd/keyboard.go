@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"atomicgo.dev/keyboard"
+	"atomicgo.dev/keyboard/keys"
+	"github.com/primlock/zoomies/internal/logger"
+	"github.com/primlock/zoomies/zoomies"
+	"golang.org/x/term"
+)
+
+// KeyHints are shown with the progress of a run while key presses control it.
+const KeyHints = "[s] skip  [q] quit  [+/-] connections"
+
+// The time given to the key listener to restore the terminal once the run is over.
+const keyListenerStopTimeout = time.Second
+
+// listenKeys controls the run with key presses until the returned function is called. Nothing is
+// listened for when stdin is not a terminal, which is reported by ok.
+func listenKeys(ctx context.Context, control *zoomies.Control) (stop func(), ok bool) {
+	if !isTerminal(os.Stdin) {
+		return func() {}, false
+	}
+
+	// The terminal is restored here too since the listener does not when it is stopped while it
+	// waits for a key.
+	fd := int(os.Stdin.Fd())
+	state, err := term.GetState(fd)
+	if err != nil {
+		return func() {}, false
+	}
+
+	var stopping atomic.Bool
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		err := keyboard.Listen(func(key keys.Key) (bool, error) {
+			if stopping.Load() {
+				return true, nil
+			}
+
+			handleKey(control, key)
+			return false, nil
+		})
+		if err != nil {
+			logger.FromContext(ctx).Debug("the key listener stopped", "error", err)
+		}
+	}()
+
+	return func() {
+		select {
+		case <-done:
+		default:
+			stopping.Store(true)
+			keyboard.SimulateKeyPress(keys.Null)
+
+			select {
+			case <-done:
+			case <-time.After(keyListenerStopTimeout):
+			}
+		}
+
+		term.Restore(fd, state)
+	}, true
+}
+
+// handleKey controls the run with the key that was pressed. The terminal does not turn Ctrl+C into
+// an interrupt while keys are listened for, so it aborts the run like q.
+func handleKey(control *zoomies.Control, key keys.Key) {
+	switch key.Code {
+	case keys.CtrlC:
+		control.Abort()
+	case keys.RuneKey:
+		switch key.String() {
+		case "s", "S":
+			control.Skip()
+		case "q", "Q":
+			control.Abort()
+		case "+", "=":
+			control.AddConnection()
+		case "-", "_":
+			control.RemoveConnection()
+		}
+	}
+}
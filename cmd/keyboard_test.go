@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"testing"
+
+	"atomicgo.dev/keyboard/keys"
+	"github.com/primlock/zoomies/zoomies"
+	"gotest.tools/v3/assert"
+)
+
+func TestHandleKey(t *testing.T) {
+	testCases := []struct {
+		name        string
+		keys        []keys.Key
+		connections int
+	}{
+		{name: "Connections added", keys: []keys.Key{runeKey('+'), runeKey('=')}, connections: 2},
+		{name: "Connections removed down to one", keys: []keys.Key{runeKey('+'), runeKey('+'), runeKey('-'), runeKey('-'), runeKey('-')}, connections: 1},
+		{name: "Other keys ignored", keys: []keys.Key{runeKey('x'), {Code: keys.Enter}}, connections: 0},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			control := zoomies.NewControl()
+			for _, k := range tt.keys {
+				handleKey(control, k)
+			}
+
+			assert.Equal(t, control.Connections(), tt.connections)
+		})
+	}
+}
+
+// runeKey returns the key press of the character.
+func runeKey(r rune) keys.Key {
+	return keys.Key{Code: keys.RuneKey, Runes: []rune{r}}
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/check"
+	"github.com/primlock/zoomies/internal/logger"
+	"github.com/primlock/zoomies/internal/nagios"
+	"github.com/primlock/zoomies/internal/sink"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	ErrUnknownOutputFormat = errors.New("output must be one of text, json or nagios")
+	ErrNagiosWithBaseline  = errors.New("the nagios output cannot be combined with --baseline")
+	ErrInfluxStdout        = errors.New("--influx - writes to stdout and cannot be combined with the json or nagios output or --tui")
+)
+
+const (
+	OutputText    = "text"
+	OutputJSON    = "json"
+	OutputNagios  = "nagios"
+	DefaultOutput = OutputText
+)
+
+// setupOutput prepares the terminal for the output format. The progress and logs are always
+// written to stderr; formats meant for other programs keep stdout for the result alone and move the
+// text results to stderr too, as does the line protocol of --influx - in place of the results.
+func setupOutput(params *Parameters) error {
+	switch params.Output {
+	case OutputText:
+	case OutputJSON, OutputNagios:
+		pterm.SetDefaultOutput(os.Stderr)
+	default:
+		return ErrUnknownOutputFormat
+	}
+
+	if params.Output == OutputNagios && params.Baseline != "" {
+		return ErrNagiosWithBaseline
+	}
+
+	if params.InfluxDestination == sink.InfluxStdout {
+		if params.Output != OutputText || params.TUI {
+			return ErrInfluxStdout
+		}
+
+		pterm.SetDefaultOutput(os.Stderr)
+	}
+
+	return nil
+}
+
+// setupColor turns off the colors and styling of the output with --no-color, when the NO_COLOR
+// environment variable is set or when stdout is not a terminal.
+func setupColor(params *Parameters) {
+	if params.NoColor || os.Getenv("NO_COLOR") != "" || !isTerminal(os.Stdout) {
+		pterm.DisableStyling()
+	}
+}
+
+// setupLogger creates the logger of the command from the parameters and carries it in the context
+// of the command. The records are written to stderr, or appended to the log file when one is given.
+func setupLogger(cmd *cobra.Command, params *Parameters) error {
+	level := params.LogLevel
+	if params.Verbose {
+		level = "debug"
+	}
+
+	// The level and format are checked before the log file is created.
+	if _, err := logger.New(io.Discard, params.LogFormat, level); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stderr
+	if params.LogFile != "" {
+		f, err := os.OpenFile(params.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("error opening the log file: %w", err)
+		}
+
+		w = f
+	}
+
+	l, err := logger.New(w, params.LogFormat, level)
+	if err != nil {
+		return err
+	}
+
+	cmd.SetContext(logger.NewContext(cmd.Context(), l))
+	return nil
+}
+
+// isTerminal reports whether the file is a terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// writeOutput prints the result to w in the output format. The text format was already printed
+// while the tests ran.
+func writeOutput(w io.Writer, params *Parameters, result *api.Result) error {
+	if params.Output != OutputJSON {
+		return nil
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// nagiosThresholds parses the warning thresholds from --warning and the critical ones from
+// --critical, or the --min and --max flags when it is not set.
+func nagiosThresholds(params *Parameters) (warning, critical *check.Thresholds, err error) {
+	if warning, err = parseThresholdMap("warning", params.Warning); err != nil {
+		return nil, nil, err
+	}
+
+	if critical, err = parseThresholdMap("critical", params.Critical); err != nil {
+		return nil, nil, err
+	}
+
+	if critical == nil {
+		if critical, err = parseThresholds(params); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return warning, critical, nil
+}
+
+// writeNagios prints the status line of a check plugin for the result and returns an error
+// carrying the plugin exit code when the status is not OK.
+func writeNagios(w io.Writer, result *api.Result, warning, critical *check.Thresholds) error {
+	status, line := nagios.Report(result, warning, critical)
+	fmt.Fprintln(w, line)
+
+	if status == nagios.OK {
+		return nil
+	}
+
+	return &ExitCodeError{Code: int(status), Err: fmt.Errorf("%w: %s", ErrThresholdCheckFailed, status)}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/nagios"
+	"gotest.tools/v3/assert"
+)
+
+func TestInvalidNagiosFlags(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected error
+	}{
+		{name: "Unknown warning threshold", args: []string{"--output=nagios", "--warning=speed=100Mbps"}, expected: ErrUnknownThreshold},
+		{name: "Invalid critical latency", args: []string{"--output=nagios", "--critical=latency=30"}, expected: ErrInvalidLatency},
+		{name: "Combined with a baseline", args: []string{"--output=nagios", "--baseline=last.json"}, expected: ErrNagiosWithBaseline},
+		{name: "Run by the daemon", args: []string{"daemon", "--output=nagios"}, expected: ErrDaemonNagiosOutput},
+		{name: "Quiet dashboard", args: []string{"--quiet", "--tui"}, expected: ErrQuietWithTUI},
+		{name: "Influx on stdout with the json output", args: []string{"--influx=-", "--output=json"}, expected: ErrInfluxStdout},
+		{name: "Influx on stdout with the dashboard", args: []string{"--influx=-", "--tui"}, expected: ErrInfluxStdout},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCmd()
+
+			c.SetOutput(&bytes.Buffer{})
+			c.SetArgs(tt.args)
+
+			got := c.Execute()
+
+			assert.ErrorIs(t, got, tt.expected)
+		})
+	}
+}
+
+func TestNagiosUnknownOnInvalidFlags(t *testing.T) {
+	testCases := []struct {
+		name string
+		args []string
+	}{
+		{name: "Invalid warning threshold", args: []string{"--output=nagios", "--warning=download=fast"}},
+		{name: "Duration out of bounds", args: []string{"--output=nagios", "--duration=2"}},
+		{name: "Combined with a baseline", args: []string{"--output=nagios", "--baseline=last.json"}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, stderr bytes.Buffer
+
+			c := NewCmd()
+			c.SetOut(&out)
+			c.SetErr(&stderr)
+			c.SetArgs(tt.args)
+
+			err := c.Execute()
+
+			assert.Equal(t, ExitCode(err), int(nagios.Unknown))
+			assert.Assert(t, strings.HasPrefix(out.String(), "ZOOMIES UNKNOWN - "), out.String())
+			assert.Equal(t, stderr.String(), "")
+		})
+	}
+}
+
+func TestWriteNagios(t *testing.T) {
+	result := &api.Result{
+		Download: &api.TransferResult{Bytes: 125000000, Duration: 10 * time.Second},
+		Upload:   &api.TransferResult{Bytes: 25000000, Duration: 10 * time.Second},
+		Latency:  &api.LatencyResult{Ping: 25 * time.Millisecond, PacketLoss: 2},
+	}
+
+	testCases := []struct {
+		name     string
+		params   Parameters
+		expected nagios.Status
+	}{
+		{name: "No thresholds", params: Parameters{}, expected: nagios.OK},
+		{name: "Within the thresholds", params: Parameters{Warning: map[string]string{"download": "50Mbps"}, Critical: map[string]string{"loss": "5%"}}, expected: nagios.OK},
+		{name: "Above the warning latency", params: Parameters{Warning: map[string]string{"latency": "20ms"}, Critical: map[string]string{"latency": "50ms"}}, expected: nagios.Warning},
+		{name: "Below the critical download", params: Parameters{Warning: map[string]string{"latency": "20ms"}, Critical: map[string]string{"download": "200Mbps"}}, expected: nagios.Critical},
+		{name: "Critical from the threshold flags", params: Parameters{MaxLoss: "1%"}, expected: nagios.Critical},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			warning, critical, err := nagiosThresholds(&tt.params)
+			assert.NilError(t, err)
+
+			var out bytes.Buffer
+			err = writeNagios(&out, result, warning, critical)
+
+			assert.Equal(t, ExitCode(err), int(tt.expected))
+			assert.Assert(t, strings.HasPrefix(out.String(), "ZOOMIES "+tt.expected.String()))
+			assert.Assert(t, strings.Contains(out.String(), " | download="))
+		})
+	}
+}
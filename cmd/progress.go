@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/zoomies"
+	"github.com/pterm/pterm"
+)
+
+var (
+	CompletedPrinter = pterm.PrefixPrinter{
+		Prefix: pterm.Prefix{
+			Text: pterm.ThemeDefault.Checkmark.Checked,
+		},
+	}
+
+	Spinner = pterm.SpinnerPrinter{
+		Sequence:            pterm.DefaultSpinner.Sequence,
+		Style:               &pterm.Style{pterm.FgGreen},
+		Delay:               pterm.DefaultSpinner.Delay,
+		ShowTimer:           false,
+		TimerRoundingFactor: time.Second,
+		TimerStyle:          &pterm.ThemeDefault.TimerStyle,
+		MessageStyle:        &pterm.ThemeDefault.SpinnerTextStyle,
+		InfoPrinter:         &CompletedPrinter,
+		Writer:              os.Stderr,
+	}
+)
+
+// phaseDescriptions are shown by the spinner while each phase runs.
+var phaseDescriptions = map[string]string{
+	zoomies.PhaseTokenDiscovery:   "Getting the api endpoint token",
+	zoomies.PhaseServerList:       "Getting the list of test servers",
+	zoomies.PhaseCandidateProbing: "Choosing the nearest server",
+	zoomies.PhaseLatency:          "Running the latency test",
+	zoomies.PhaseDownload:         "Running the download test",
+	zoomies.PhaseUpload:           "Running the upload test",
+}
+
+// The ways the progress of a run is shown on stderr.
+const (
+	// A spinner for each phase, on a terminal.
+	ProgressSpinner = "spinner"
+
+	// A line as each phase starts and every PlainProgressInterval of a transfer, for logs.
+	ProgressPlain = "plain"
+
+	// Nothing, with --quiet.
+	ProgressNone = "none"
+)
+
+// How often a line is printed with the progress of a transfer when the progress is plain.
+const PlainProgressInterval = 5 * time.Second
+
+// progressMode returns how the progress is shown with the parameters: not at all when quiet, with
+// a spinner when stderr is a terminal and with plain lines otherwise.
+func progressMode(params *Parameters) string {
+	switch {
+	case params.Quiet:
+		return ProgressNone
+	case !isTerminal(os.Stderr):
+		return ProgressPlain
+	}
+
+	return ProgressSpinner
+}
+
+// textObserver shows the progress of a run on stderr and prints the result of each test to the
+// output as its phase ends. The client, the server and the notes between the results are left out
+// when quiet.
+type textObserver struct {
+	binary     bool
+	noDownload bool
+	noUpload   bool
+	keys       bool
+	progress   string
+	progressW  io.Writer
+
+	spinner  *pterm.SpinnerPrinter
+	target   *zoomies.Target
+	latency  api.Samples
+	last     zoomies.Sample
+	reported time.Duration
+}
+
+func newTextObserver(params *Parameters, keys bool) *textObserver {
+	return &textObserver{
+		binary:     params.Config.BinaryUnitPrefix,
+		noDownload: params.NoDownload,
+		noUpload:   params.NoUpload,
+		keys:       keys,
+		progress:   progressMode(params),
+		progressW:  os.Stderr,
+	}
+}
+
+func (o *textObserver) OnPhaseStart(phase string, target *zoomies.Target) {
+	if target != nil && o.target == nil {
+		o.target = target
+		if o.progress != ProgressNone {
+			printTarget(target)
+		}
+	}
+
+	o.latency = api.Samples{}
+	o.last = zoomies.Sample{}
+	o.reported = 0
+
+	o.stop()
+	switch o.progress {
+	case ProgressSpinner:
+		o.spinner, _ = Spinner.WithWriter(o.progressW).Start(o.text(phase, phaseDescriptions[phase]))
+	case ProgressPlain:
+		fmt.Fprintln(o.progressW, phaseDescriptions[phase])
+	}
+}
+
+func (o *textObserver) OnSample(phase string, sample zoomies.Sample) {
+	switch phase {
+	case zoomies.PhaseLatency:
+		o.latency.Method = sample.Method
+		if sample.Lost {
+			o.latency.Lost++
+		} else {
+			o.latency.RTTs = append(o.latency.RTTs, sample.RTT)
+		}
+	case zoomies.PhaseDownload, zoomies.PhaseUpload:
+		if sample.IsRTT() {
+			return
+		}
+
+		o.last = sample
+		status := fmt.Sprintf("%s (%s, %d connections)", phaseDescriptions[phase], api.BitRate(sample.BitsPerSecond(), o.binary), sample.Connections)
+
+		switch {
+		case o.spinner != nil:
+			o.spinner.UpdateText(o.text(phase, status))
+		case o.progress == ProgressPlain && sample.Elapsed-o.reported >= PlainProgressInterval:
+			o.reported = sample.Elapsed
+			fmt.Fprintln(o.progressW, status)
+		}
+	}
+}
+
+func (o *textObserver) OnPhaseEnd(phase string, err error) {
+	if err != nil {
+		o.stop()
+		return
+	}
+
+	switch phase {
+	case zoomies.PhaseLatency:
+		l := o.latency.Latency()
+
+		// Name the method when it is not ICMP.
+		via := ""
+		if l.Method != api.ProbeICMP {
+			via = ", via " + l.Method
+		}
+
+		o.result(fmt.Sprintf("Ping: %s (jitter: %s, loss: %.1f%%%s)", l.Ping.Round(time.Millisecond), l.Jitter.Round(time.Millisecond), l.PacketLoss, via))
+	case zoomies.PhaseDownload:
+		o.result(fmt.Sprintf("Download speed: %s (%s)", api.BitRate(o.last.BitsPerSecond(), o.binary), api.BytesConsumed(o.last.Bytes, o.binary)))
+	case zoomies.PhaseUpload:
+		o.result(fmt.Sprintf("Upload speed: %s (%s)", api.BitRate(o.last.BitsPerSecond(), o.binary), api.BytesConsumed(o.last.Bytes, o.binary)))
+	default:
+		o.stop()
+	}
+
+	if o.progress == ProgressNone {
+		return
+	}
+
+	// The disabled tests are listed where they would have run.
+	if phase == zoomies.PhaseLatency && o.noDownload {
+		pterm.DefaultBasicText.Printf(" %s  Download test is disabled\n", checkmark(false))
+	}
+
+	if (phase == zoomies.PhaseDownload || (phase == zoomies.PhaseLatency && o.noDownload)) && o.noUpload {
+		pterm.DefaultBasicText.Printf(" %s  Upload test is disabled\n", checkmark(false))
+	}
+}
+
+// OnWarning leaves the warnings to the logger of the run, which adds the phase and server they
+// happened in.
+func (o *textObserver) OnWarning(string) {}
+
+// text adds the key hints to the text of the spinner in the phases the keys control.
+func (o *textObserver) text(phase, text string) string {
+	switch phase {
+	case zoomies.PhaseLatency, zoomies.PhaseDownload, zoomies.PhaseUpload:
+		if o.keys {
+			return fmt.Sprintf("%s  %s", text, pterm.FgGray.Sprint(KeyHints))
+		}
+	}
+
+	return text
+}
+
+// result ends the progress of the phase and prints the result of its test.
+func (o *textObserver) result(text string) {
+	o.stop()
+	pterm.DefaultBasicText.Printf(" %s  %s\n", checkmark(true), text)
+}
+
+// finish ends the progress and notes the retries the run took.
+func (o *textObserver) finish(report *zoomies.Report) {
+	o.stop()
+
+	if report != nil && report.Retries > 0 && o.progress != ProgressNone {
+		pterm.DefaultBasicText.Printf("Completed after %d retries\n", report.Retries)
+	}
+}
+
+// stop removes the spinner of the phase, if it is still running.
+func (o *textObserver) stop() {
+	if o.spinner != nil {
+		o.spinner.RemoveWhenDone = true
+		o.spinner.Stop()
+		o.spinner = nil
+	}
+}
+
+// checkmark returns the mark of a test that ran or was disabled, without its color when the
+// styling is turned off.
+func checkmark(ran bool) string {
+	mark := pterm.ThemeDefault.Checkmark.Unchecked
+	if ran {
+		mark = pterm.ThemeDefault.Checkmark.Checked
+	}
+
+	if pterm.RawOutput {
+		return pterm.RemoveColorFromString(mark)
+	}
+
+	return mark
+}
+
+// startProgress shows the progress of a step outside of a run the way the progress of a run is
+// shown, and returns a function that ends it with the text of its outcome.
+func startProgress(params *Parameters, text string) (done func(outcome string)) {
+	switch progressMode(params) {
+	case ProgressSpinner:
+		spinner, _ := Spinner.Start(text)
+		return func(outcome string) { spinner.Info(outcome) }
+	case ProgressPlain:
+		fmt.Fprintln(os.Stderr, text)
+		return func(outcome string) { fmt.Fprintln(os.Stderr, outcome) }
+	}
+
+	return func(outcome string) {}
+}
+
+// printTarget prints the client and the server under test.
+func printTarget(target *zoomies.Target) {
+	// A list of urls in a servers file carries no details of the client.
+	if c := target.Client; c.IP != "" {
+		pterm.DefaultBasicText.Printf("Testing from Origin: %s — %s, %s [%s]\n", c.ISP, c.Location.City, c.Location.Country, c.IP)
+	}
+
+	if ip, err := target.Server.GetIPv4(); err == nil {
+		pterm.DefaultBasicText.Printf("Testing Server: %s [%s]\n", serverLocation(target.Server), ip)
+	} else {
+		pterm.DefaultBasicText.Printf("Testing Server: %s\n", serverLocation(target.Server))
+	}
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/zoomies"
+	"github.com/pterm/pterm"
+	"gotest.tools/v3/assert"
+)
+
+func TestTextObserver(t *testing.T) {
+	testCases := []struct {
+		name     string
+		progress string
+		results  []string
+		missing  []string
+		lines    []string
+	}{
+		{
+			name:     "Plain progress",
+			progress: ProgressPlain,
+			results:  []string{"Testing Server: London, GB", "Ping: 20ms", "Download speed: 16.00 Mbps (14.00 MB)"},
+			lines:    []string{"Running the latency test", "Running the download test", "Running the download test (16.00 Mbps, 3 connections)"},
+		},
+		{
+			name:     "Quiet",
+			progress: ProgressNone,
+			results:  []string{"Ping: 20ms", "Download speed: 16.00 Mbps (14.00 MB)"},
+			missing:  []string{"Testing Server", "Running"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var results, progress bytes.Buffer
+			pterm.SetDefaultOutput(&results)
+			t.Cleanup(func() { pterm.SetDefaultOutput(os.Stdout) })
+
+			o := newTextObserver(NewParameters(), false)
+			o.progress, o.progressW = tt.progress, &progress
+
+			server := api.Server{Name: "lhr1"}
+			server.Location.City, server.Location.Country = "London", "GB"
+			target := &zoomies.Target{Server: server}
+
+			o.OnPhaseStart(zoomies.PhaseLatency, target)
+			o.OnSample(zoomies.PhaseLatency, zoomies.Sample{RTT: 20 * time.Millisecond, Method: api.ProbeICMP})
+			o.OnPhaseEnd(zoomies.PhaseLatency, nil)
+
+			// A progress line is printed every PlainProgressInterval.
+			o.OnPhaseStart(zoomies.PhaseDownload, target)
+			for _, s := range []time.Duration{time.Second, 6 * time.Second, 7 * time.Second} {
+				o.OnSample(zoomies.PhaseDownload, zoomies.Sample{Elapsed: s, Bytes: uint64(s/time.Second) * 2_000_000, Connections: 3})
+			}
+			o.OnPhaseEnd(zoomies.PhaseDownload, nil)
+			o.finish(nil)
+
+			got := pterm.RemoveColorFromString(results.String())
+			for _, want := range tt.results {
+				assert.Assert(t, strings.Contains(got, want), "%q is missing from the results:\n%s", want, got)
+			}
+			for _, unwanted := range tt.missing {
+				assert.Assert(t, !strings.Contains(got+progress.String(), unwanted), "%q was printed:\n%s%s", unwanted, got, progress.String())
+			}
+
+			var lines []string
+			if progress.Len() > 0 {
+				lines = strings.Split(strings.TrimSpace(progress.String()), "\n")
+			}
+			assert.DeepEqual(t, lines, tt.lines)
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/config"
+	"github.com/primlock/zoomies/internal/logger"
+	"github.com/primlock/zoomies/zoomies"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrUnknownServersOutput  = errors.New("output must be one of text or json")
+	ErrUnknownProbe          = errors.New("probe must be one of icmp, tcp or http")
+	ErrProbeCountOutOfBounds = errors.New("count must be in the range 1-10 inclusive")
+)
+
+const (
+	ServersCommandName        = "servers"
+	ServersCommandDescription = "list and rank the test servers fast.com hands out without running any transfers"
+	DefaultProbeCount         = 3
+	MaxProbeCount             = 10
+)
+
+// probeTypes are the ways a server can be probed, in the order they are shown.
+var probeTypes = []api.Prober{api.ICMPProbe, api.TCPProbe, api.HTTPProbe}
+
+// ServerReport describes a test server and how it responded to each probe type.
+type ServerReport struct {
+	Rank    int           `json:"rank"`
+	Name    string        `json:"name"`
+	City    string        `json:"city"`
+	Country string        `json:"country"`
+	URL     string        `json:"url"`
+	IPs     []string      `json:"ips"`
+	Probes  []ProbeReport `json:"probes"`
+}
+
+// ProbeReport holds the round-trip times measured by one probe type. The error is kept when none of
+// the samples got a reply.
+type ProbeReport struct {
+	Method  string        `json:"method"`
+	Samples int           `json:"samples"`
+	Lost    int           `json:"lost"`
+	Min     time.Duration `json:"min,omitempty"`
+	Avg     time.Duration `json:"avg,omitempty"`
+	Max     time.Duration `json:"max,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+func newServersCmd(params *Parameters) *cobra.Command {
+	var count int
+	var probes []string
+
+	cmd := &cobra.Command{
+		Use:   ServersCommandName,
+		Short: ServersCommandDescription,
+		Long: ServersCommandDescription + `.
+
+Every server in the list is probed with each probe type. Round-trip times measured by different
+probe types are not comparable, so the servers are ranked by the first probe type they answered,
+in the order icmp, tcp and http, and then by its average round-trip time. Servers that could not be
+reached are listed last.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if params.Output != OutputText && params.Output != OutputJSON {
+				return ErrUnknownServersOutput
+			}
+
+			if count < 1 || count > MaxProbeCount {
+				return ErrProbeCountOutOfBounds
+			}
+
+			selected, err := selectProbes(probes)
+			if err != nil {
+				return err
+			}
+
+			if err := setupOutput(params); err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), time.Duration(params.Config.Timeout)*time.Second)
+			defer cancel()
+
+			remote, err := zoomies.Servers(ctx, params.options())
+			if err != nil {
+				return err
+			}
+
+			done := startProgress(params, fmt.Sprintf("Probing %d servers", len(remote.Targets)))
+			reports := probeServers(ctx, remote.Targets, count, selected)
+			done(fmt.Sprintf("Probed %d servers", len(reports)))
+
+			if params.Output == OutputJSON {
+				return writeServers(cmd.OutOrStdout(), reports)
+			}
+
+			return renderServers(reports, selected)
+		},
+	}
+
+	cmd.Flags().StringVarP(&params.APIEndpointToken, "token", "t", "", "user provided api endpoint access token")
+	cmd.Flags().StringVar(&params.ServersFile, "servers-file", "", "list the servers in this file (a recorded response or a list of urls) instead of asking fast.com")
+	cmd.Flags().StringVar(&params.Record, "record", "", "save the server list discovered through fast.com to this file for use with --servers-file")
+	cmd.Flags().IntVar(&params.Retries, "retries", params.Retries, "the number of times a failed request is retried (0-10)")
+	cmd.Flags().IntVar(&params.Config.Timeout, "timeout", params.Config.Timeout, "the time in seconds the command may take before it is stopped")
+	cmd.Flags().StringVarP(&params.Output, "output", "o", params.Output, "the format the servers are printed in (text or json)")
+	cmd.Flags().IntVarP(&count, "count", "n", DefaultProbeCount, "the number of samples taken with each probe type (1-10)")
+	cmd.Flags().StringSliceVar(&probes, "probe", []string{api.ProbeICMP, api.ProbeTCP, api.ProbeHTTP}, "the probe types used (icmp, tcp, http)")
+	config.Mark(cmd.Flags(), "token", "servers-file", "retries", "timeout")
+
+	return cmd
+}
+
+// selectProbes returns the probe types with the names in the order they are shown.
+func selectProbes(names []string) ([]api.Prober, error) {
+	want := map[string]bool{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.ContainsFunc(probeTypes, func(p api.Prober) bool { return p.Method() == name }) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownProbe, name)
+		}
+
+		want[name] = true
+	}
+
+	var selected []api.Prober
+	for _, p := range probeTypes {
+		if want[p.Method()] {
+			selected = append(selected, p)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, ErrUnknownProbe
+	}
+
+	return selected, nil
+}
+
+// probeServers resolves and probes every server with each probe type, and ranks them.
+func probeServers(ctx context.Context, servers []api.Server, count int, probes []api.Prober) []ServerReport {
+	reports := make([]ServerReport, 0, len(servers))
+
+	for _, s := range servers {
+		if ctx.Err() != nil {
+			break
+		}
+
+		r := ServerReport{Name: s.Name, City: s.Location.City, Country: s.Location.Country, URL: s.URL, IPs: lookupIPs(ctx, s)}
+		for _, p := range probes {
+			r.Probes = append(r.Probes, sampleProbe(ctx, s, count, p))
+		}
+
+		logger.FromContext(ctx).Info("probed server", logger.KeyServer, s.Name, "city", s.Location.City, "country", s.Location.Country)
+		reports = append(reports, r)
+	}
+
+	rankServers(reports)
+
+	return reports
+}
+
+// rankServers sorts the reports by the first probe type each server answered and then by the
+// average round-trip time of that probe type, and numbers them.
+func rankServers(reports []ServerReport) {
+	sort.SliceStable(reports, func(i, j int) bool {
+		pi, avgI := firstReply(reports[i])
+		pj, avgJ := firstReply(reports[j])
+		if pi != pj {
+			return pi < pj
+		}
+
+		return avgI < avgJ
+	})
+
+	for i := range reports {
+		reports[i].Rank = i + 1
+	}
+}
+
+// sampleProbe probes the server count times so that the spread of the round-trip times can be
+// reported.
+func sampleProbe(ctx context.Context, s api.Server, count int, p api.Prober) ProbeReport {
+	r := ProbeReport{Method: p.Method(), Samples: count}
+
+	samples, err := p.Probe(ctx, s, count)
+	if err != nil {
+		r.Lost = count
+		r.Error = err.Error()
+		return r
+	}
+
+	r.Lost = samples.Lost
+	r.Min, r.Avg, r.Max = samples.Min(), samples.Avg(), samples.Max()
+
+	return r
+}
+
+func lookupIPs(ctx context.Context, s api.Server) []string {
+	u, err := s.GetURL()
+	if err != nil {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to resolve the server", logger.KeyServer, s.Name, "host", u.Hostname(), "error", err)
+		return nil
+	}
+
+	ips := make([]string, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP.String()
+	}
+
+	return ips
+}
+
+// firstReply returns the position of the first probe type the server answered and its average
+// round-trip time. A server that never replied gets the number of probe types so it is ranked last.
+func firstReply(r ServerReport) (int, time.Duration) {
+	for i, p := range r.Probes {
+		if p.Avg > 0 {
+			return i, p.Avg
+		}
+	}
+
+	return len(r.Probes), 0
+}
+
+func renderServers(reports []ServerReport, probes []api.Prober) error {
+	header := []string{"Rank", "Name", "City", "Country", "IPs"}
+	for _, p := range probes {
+		header = append(header, strings.ToUpper(p.Method())+" min/avg/max", "Lost")
+	}
+
+	data := pterm.TableData{header}
+	for _, r := range reports {
+		row := []string{fmt.Sprint(r.Rank), r.Name, r.City, r.Country, strings.Join(r.IPs, ", ")}
+		for _, p := range r.Probes {
+			row = append(row, formatProbe(p), fmt.Sprintf("%d/%d", p.Lost, p.Samples))
+		}
+
+		data = append(data, row)
+	}
+
+	return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
+
+func formatProbe(p ProbeReport) string {
+	if p.Avg == 0 {
+		return "unreachable"
+	}
+
+	ms := func(d time.Duration) string { return d.Round(100 * time.Microsecond).String() }
+
+	return fmt.Sprintf("%s / %s / %s", ms(p.Min), ms(p.Avg), ms(p.Max))
+}
+
+// writeServers writes the reports as indented JSON.
+func writeServers(w io.Writer, reports []ServerReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
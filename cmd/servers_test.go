@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"gotest.tools/v3/assert"
+)
+
+func TestProbeServers(t *testing.T) {
+	rtts := map[string][]time.Duration{
+		"far":  {40 * time.Millisecond, 60 * time.Millisecond},
+		"near": {10 * time.Millisecond, 20 * time.Millisecond},
+	}
+
+	probe := api.NewProber("icmp", func(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+		samples, ok := rtts[server.Name]
+		if !ok {
+			return nil, errors.New("no reply")
+		}
+
+		return &api.Samples{RTTs: samples[:count]}, nil
+	})
+
+	servers := []api.Server{
+		{Name: "down", URL: "https://127.0.0.1/speedtest"},
+		{Name: "far", URL: "https://127.0.0.2/speedtest"},
+		{Name: "near", URL: "https://127.0.0.3/speedtest"},
+	}
+
+	got := probeServers(context.Background(), servers, 2, []api.Prober{probe})
+
+	assert.Equal(t, len(got), 3)
+	assert.Equal(t, got[0].Name, "near")
+	assert.Equal(t, got[0].Rank, 1)
+	assert.DeepEqual(t, got[0].IPs, []string{"127.0.0.3"})
+	assert.DeepEqual(t, got[0].Probes, []ProbeReport{{Method: "icmp", Samples: 2, Min: 10 * time.Millisecond, Avg: 15 * time.Millisecond, Max: 20 * time.Millisecond}})
+	assert.Equal(t, got[1].Name, "far")
+	assert.Equal(t, got[2].Name, "down")
+	assert.Equal(t, got[2].Probes[0].Lost, 2)
+	assert.Equal(t, got[2].Probes[0].Error, "no reply")
+	assert.Equal(t, formatProbe(got[2].Probes[0]), "unreachable")
+
+	var out bytes.Buffer
+	assert.NilError(t, writeServers(&out, got))
+
+	var decoded []ServerReport
+	assert.NilError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.DeepEqual(t, decoded, got)
+}
+
+func TestRankServers(t *testing.T) {
+	probes := func(avgs ...time.Duration) []ProbeReport {
+		var reports []ProbeReport
+		for _, avg := range avgs {
+			reports = append(reports, ProbeReport{Avg: avg})
+		}
+		return reports
+	}
+
+	reports := []ServerReport{
+		{Name: "down", Probes: probes(0, 0, 0)},
+		{Name: "http-only", Probes: probes(0, 0, 5*time.Millisecond)},
+		{Name: "tcp-fast", Probes: probes(0, 8*time.Millisecond, 30*time.Millisecond)},
+		{Name: "icmp-slow", Probes: probes(40*time.Millisecond, 3*time.Millisecond, 50*time.Millisecond)},
+		{Name: "icmp-fast", Probes: probes(20*time.Millisecond, 0, 0)},
+	}
+
+	rankServers(reports)
+
+	var names []string
+	for i, r := range reports {
+		names = append(names, r.Name)
+		assert.Equal(t, r.Rank, i+1)
+	}
+
+	assert.DeepEqual(t, names, []string{"icmp-fast", "icmp-slow", "tcp-fast", "http-only", "down"})
+}
+
+func TestServersCmdInvalidFlags(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected error
+	}{
+		{name: "Unknown probe type", args: []string{"servers", "--probe=udp"}, expected: ErrUnknownProbe},
+		{name: "Count above the upper boundary", args: []string{"servers", "--count=50"}, expected: ErrProbeCountOutOfBounds},
+		{name: "Nagios output", args: []string{"servers", "--output=nagios"}, expected: ErrUnknownServersOutput},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCmd()
+
+			c.SetOutput(&bytes.Buffer{})
+			c.SetArgs(tt.args)
+
+			assert.ErrorIs(t, c.Execute(), tt.expected)
+		})
+	}
+}
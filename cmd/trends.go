@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/config"
+	"github.com/primlock/zoomies/internal/history"
+	"github.com/primlock/zoomies/internal/stats"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var ErrUnknownTrendMetric = errors.New("metric must be one of download, upload, latency or all")
+
+const (
+	TrendsCommandName        = "trends"
+	TrendsCommandDescription = "show daily, weekly and time-of-day trends of previous runs"
+	DefaultTrendGrouping     = history.Daily
+	DefaultTrendMetric       = "all"
+	TrendBarWidth            = 30
+)
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// trendMetric describes how one measurement is pulled from a bucket and displayed.
+type trendMetric struct {
+	name    string
+	summary func(b history.Bucket) stats.Summary
+	format  func(v float64) string
+}
+
+func newTrendsCmd(params *Parameters) *cobra.Command {
+	filter := &HistoryFilter{}
+	var by, metric string
+
+	cmd := &cobra.Command{
+		Use:   TrendsCommandName,
+		Short: TrendsCommandDescription,
+		Long: TrendsCommandDescription + `.
+
+The results kept in the history are grouped by day, ISO week or hour of the day and the 10th
+percentile, median and 90th percentile of each group are shown with a bar of the median and a
+sparkline of the medians across the groups.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			grouping, err := history.ParseGrouping(by)
+			if err != nil {
+				return err
+			}
+
+			metrics, err := trendMetrics(metric, params.Config.BinaryUnitPrefix)
+			if err != nil {
+				return err
+			}
+
+			records, err := listHistory(params, filter)
+			if err != nil {
+				return err
+			}
+
+			if len(records) == 0 {
+				pterm.DefaultBasicText.Println("No results found")
+				return nil
+			}
+
+			buckets := history.Trends(records, grouping, time.Local)
+			for _, m := range metrics {
+				if err := renderTrend(m, buckets); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+
+	addHistoryFilterFlags(cmd.Flags(), filter)
+	cmd.Flags().StringVar(&by, "by", string(DefaultTrendGrouping), "group the results by day, week or hour of the day")
+	cmd.Flags().StringVarP(&metric, "metric", "m", DefaultTrendMetric, "the measurement to show (download, upload, latency or all)")
+	cmd.Flags().BoolVarP(&params.Config.BinaryUnitPrefix, "binary", "b", params.Config.BinaryUnitPrefix, "display the unit prefixes in binary (Mibit/s) instead of decimal (Mbps)")
+	config.Mark(cmd.Flags(), "binary")
+
+	return cmd
+}
+
+func trendMetrics(name string, binary bool) ([]trendMetric, error) {
+	rate := func(v float64) string { return api.BitRate(v, binary) }
+	ms := func(v float64) string { return fmt.Sprintf("%.1f ms", v) }
+
+	all := []trendMetric{
+		{name: "Download", summary: func(b history.Bucket) stats.Summary { return b.Download }, format: rate},
+		{name: "Upload", summary: func(b history.Bucket) stats.Summary { return b.Upload }, format: rate},
+		{name: "Latency", summary: func(b history.Bucket) stats.Summary { return b.Latency }, format: ms},
+	}
+
+	if name == "all" {
+		return all, nil
+	}
+
+	for _, m := range all {
+		if strings.EqualFold(m.name, name) {
+			return []trendMetric{m}, nil
+		}
+	}
+
+	return nil, ErrUnknownTrendMetric
+}
+
+// renderTrend prints a table of the percentiles of each bucket with a bar of its median, followed
+// by a sparkline of the medians.
+func renderTrend(m trendMetric, buckets []history.Bucket) error {
+	medians := make([]float64, len(buckets))
+	for i, b := range buckets {
+		medians[i] = m.summary(b).Median
+	}
+
+	max := 0.0
+	for _, v := range medians {
+		if !math.IsNaN(v) && v > max {
+			max = v
+		}
+	}
+
+	data := pterm.TableData{{"Period", "Runs", "p10", "Median", "p90", ""}}
+	for i, b := range buckets {
+		s := m.summary(b)
+		if s.Count == 0 {
+			data = append(data, []string{b.Label, "0", "-", "-", "-", ""})
+			continue
+		}
+
+		data = append(data, []string{
+			b.Label,
+			fmt.Sprint(s.Count),
+			m.format(s.P10),
+			m.format(s.Median),
+			m.format(s.P90),
+			pterm.FgGreen.Sprint(bar(medians[i], max, TrendBarWidth)),
+		})
+	}
+
+	pterm.DefaultSection.Println(m.name)
+
+	if err := pterm.DefaultTable.WithHasHeader().WithData(data).Render(); err != nil {
+		return err
+	}
+
+	pterm.DefaultBasicText.Printf("\nMedian trend: %s\n", sparkline(medians))
+
+	return nil
+}
+
+// bar returns a horizontal bar of the value scaled so that max fills the width.
+func bar(v, max float64, width int) string {
+	if max <= 0 || math.IsNaN(v) {
+		return ""
+	}
+
+	return strings.Repeat("█", int(math.Round(v/max*float64(width))))
+}
+
+// sparkline renders the values as a single line of block characters scaled between their minimum
+// and maximum. Missing values are shown as a space.
+func sparkline(values []float64) string {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+		}
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		switch {
+		case math.IsNaN(v):
+			b.WriteRune(' ')
+		case hi == lo:
+			b.WriteRune(sparkTicks[len(sparkTicks)/2])
+		default:
+			i := int(math.Round((v - lo) / (hi - lo) * float64(len(sparkTicks)-1)))
+			b.WriteRune(sparkTicks[i])
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"math"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSparkline(t *testing.T) {
+	testCases := []struct {
+		name     string
+		values   []float64
+		expected string
+	}{
+		{name: "Ascending", values: []float64{0, 1, 2, 3, 4, 5, 6, 7}, expected: "▁▂▃▄▅▆▇█"},
+		{name: "Flat", values: []float64{3, 3, 3}, expected: "▅▅▅"},
+		{name: "Missing values", values: []float64{1, math.NaN(), 8}, expected: "▁ █"},
+		{name: "Empty", values: nil, expected: ""},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, sparkline(tt.values), tt.expected)
+		})
+	}
+}
+
+func TestTrendMetrics(t *testing.T) {
+	all, err := trendMetrics("all", false)
+	assert.NilError(t, err)
+	assert.Equal(t, len(all), 3)
+
+	one, err := trendMetrics("latency", false)
+	assert.NilError(t, err)
+	assert.Equal(t, one[0].name, "Latency")
+
+	_, err = trendMetrics("jitter", false)
+	assert.Error(t, err, ErrUnknownTrendMetric.Error())
+}
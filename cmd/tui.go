@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/zoomies"
+	"github.com/pterm/pterm"
+)
+
+var ErrQuietWithTUI = errors.New("--quiet cannot be combined with --tui")
+
+const (
+	// The number of samples shown by each sparkline of the dashboard.
+	TUIHistory = 60
+
+	// The number of warnings kept on the dashboard.
+	TUIWarnings = 3
+)
+
+// runObserver shows the progress of a run in the terminal and its result once it finishes. The
+// report is nil when the run failed.
+type runObserver interface {
+	zoomies.Observer
+	finish(report *zoomies.Report)
+}
+
+// liveArea is a region of the terminal that is redrawn in place.
+type liveArea interface {
+	Update(text ...any)
+	Stop() error
+}
+
+// startArea starts the full-screen area the dashboard is drawn in. The pterm area always draws on
+// stdout, so the tests replace it.
+var startArea = defaultStartArea
+
+func defaultStartArea() liveArea {
+	area, _ := pterm.DefaultArea.WithFullscreen().WithRemoveWhenDone().Start()
+	return area
+}
+
+// tuiObserver shows the progress of a run as a full-screen dashboard with the throughput of the
+// transfers, the latency under load, the connections in flight and the server under test, and
+// prints a summary panel once the run finishes.
+type tuiObserver struct {
+	binary bool
+	keys   bool
+
+	area liveArea
+
+	phase    string
+	started  time.Time
+	target   *zoomies.Target
+	progress map[string]zoomies.Sample
+	rates    map[string][]float64
+	loaded   []float64
+	lost     int
+	warnings []string
+}
+
+func newTUIObserver(params *Parameters, keys bool) *tuiObserver {
+	return &tuiObserver{
+		binary:   params.Config.BinaryUnitPrefix,
+		keys:     keys,
+		progress: map[string]zoomies.Sample{},
+		rates:    map[string][]float64{},
+	}
+}
+
+func (o *tuiObserver) OnPhaseStart(phase string, target *zoomies.Target) {
+	o.phase, o.started = phase, time.Now()
+	if target != nil {
+		o.target = target
+	}
+
+	o.render()
+}
+
+func (o *tuiObserver) OnSample(phase string, sample zoomies.Sample) {
+	switch {
+	case sample.Lost:
+		o.lost++
+	case sample.IsRTT():
+		o.loaded = appendHistory(o.loaded, float64(sample.RTT)/float64(time.Millisecond))
+	default:
+		o.progress[phase] = sample
+		o.rates[phase] = appendHistory(o.rates[phase], sample.BitsPerSecond())
+	}
+
+	o.render()
+}
+
+func (o *tuiObserver) OnPhaseEnd(phase string, err error) {
+	o.phase = ""
+	o.render()
+}
+
+func (o *tuiObserver) OnWarning(msg string) {
+	o.warnings = append(o.warnings, msg)
+	if len(o.warnings) > TUIWarnings {
+		o.warnings = o.warnings[len(o.warnings)-TUIWarnings:]
+	}
+
+	o.render()
+}
+
+// finish closes the dashboard and prints the summary of the run.
+func (o *tuiObserver) finish(report *zoomies.Report) {
+	if o.area != nil {
+		o.area.Stop()
+		o.area = nil
+	}
+
+	if report != nil {
+		pterm.DefaultBox.WithTitle("zoomies").Println(renderSummary(report, o.binary))
+	}
+}
+
+// render draws the dashboard, starting it with the first event of the run.
+func (o *tuiObserver) render() {
+	if o.area == nil {
+		o.area = startArea()
+	}
+
+	o.area.Update(o.dashboard())
+}
+
+// dashboard lays out the panels of the dashboard.
+func (o *tuiObserver) dashboard() string {
+	box := func(title, body string) pterm.Panel {
+		return pterm.Panel{Data: pterm.DefaultBox.WithTitle(title).Sprint(body)}
+	}
+
+	server := "Choosing the nearest server"
+	if o.target != nil {
+		server = fmt.Sprintf("%s\n%s", serverLocation(o.target.Server), o.target.Server.Name)
+		if c := o.target.Client; c.IP != "" {
+			server += fmt.Sprintf("\nfrom %s [%s]", c.ISP, c.IP)
+		}
+	}
+
+	status := "Waiting"
+	if o.phase != "" {
+		status = fmt.Sprintf("%s\n%s", phaseDescriptions[o.phase], time.Since(o.started).Round(time.Second))
+	}
+
+	connections := 0
+	if o.phase == zoomies.PhaseDownload || o.phase == zoomies.PhaseUpload {
+		connections = o.progress[o.phase].Connections
+	}
+	status += fmt.Sprintf("\nConnections: %d", connections)
+	if o.keys {
+		status += "\n" + pterm.FgGray.Sprint(KeyHints)
+	}
+
+	loaded := "Measured during the transfers"
+	if len(o.loaded) > 0 {
+		loaded = fmt.Sprintf("%s  %.1f ms (lost %d)", pterm.FgYellow.Sprint(sparkline(o.loaded)), o.loaded[len(o.loaded)-1], o.lost)
+	}
+
+	panels := pterm.Panels{
+		{box("Server", server), box("Status", status)},
+		{box("Download", o.transfer(zoomies.PhaseDownload)), box("Upload", o.transfer(zoomies.PhaseUpload))},
+		{box("Loaded latency", loaded)},
+	}
+
+	if len(o.warnings) > 0 {
+		panels = append(panels, []pterm.Panel{box("Warnings", strings.Join(o.warnings, "\n"))})
+	}
+
+	s, _ := pterm.DefaultPanel.WithPanels(panels).Srender()
+
+	return s
+}
+
+// transfer describes the throughput of the download or upload phase.
+func (o *tuiObserver) transfer(phase string) string {
+	p, ok := o.progress[phase]
+	if !ok {
+		return "Not started"
+	}
+
+	return fmt.Sprintf("%s\n%s  %s",
+		pterm.FgGreen.Sprint(sparkline(o.rates[phase])),
+		api.BitRate(p.BitsPerSecond(), o.binary),
+		api.BytesConsumed(p.Bytes, o.binary),
+	)
+}
+
+// renderSummary describes the result of a run for the summary panel.
+func renderSummary(report *zoomies.Report, binary bool) string {
+	rows := [][]string{{"Server", serverLocation(report.Server)}}
+
+	if l := report.Latency; l != nil {
+		rows = append(rows, []string{"Ping", fmt.Sprintf("%s (jitter: %s, loss: %.1f%%, %s)", l.Ping.Round(time.Millisecond), l.Jitter.Round(time.Millisecond), l.PacketLoss, l.Method)})
+	}
+
+	for _, t := range []struct {
+		name   string
+		result *api.TransferResult
+	}{{"Download", report.Download}, {"Upload", report.Upload}} {
+		if t.result == nil {
+			continue
+		}
+
+		rows = append(rows, []string{t.name, fmt.Sprintf("%s (%s)", api.BitRate(t.result.BitsPerSecond(), binary), api.BytesConsumed(t.result.Bytes, binary))})
+		if l := t.result.LoadedLatency; l != nil {
+			rows = append(rows, []string{t.name + " latency", fmt.Sprintf("%s (jitter: %s)", l.Ping.Round(time.Millisecond), l.Jitter.Round(time.Millisecond))})
+		}
+	}
+
+	if report.Retries > 0 {
+		rows = append(rows, []string{"Retries", fmt.Sprint(report.Retries)})
+	}
+
+	if len(report.Warnings) > 0 {
+		rows = append(rows, []string{"Warnings", fmt.Sprint(len(report.Warnings))})
+	}
+
+	var b strings.Builder
+	for i, r := range rows {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		fmt.Fprintf(&b, "%-18s %s", r[0], r[1])
+	}
+
+	return b.String()
+}
+
+// appendHistory appends the value, keeping the last TUIHistory values.
+func appendHistory(values []float64, v float64) []float64 {
+	values = append(values, v)
+	if len(values) > TUIHistory {
+		values = values[len(values)-TUIHistory:]
+	}
+
+	return values
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/zoomies"
+	"github.com/pterm/pterm"
+	"gotest.tools/v3/assert"
+)
+
+// recordedArea keeps the frames of the dashboard in place of the terminal area.
+type recordedArea struct {
+	frames  []string
+	stopped bool
+}
+
+func (a *recordedArea) Update(text ...any) { a.frames = append(a.frames, pterm.Sprint(text...)) }
+func (a *recordedArea) Stop() error        { a.stopped = true; return nil }
+
+func TestTUIDashboard(t *testing.T) {
+	area := &recordedArea{}
+	startArea = func() liveArea { return area }
+	t.Cleanup(func() { startArea = defaultStartArea })
+
+	var summary bytes.Buffer
+	pterm.SetDefaultOutput(&summary)
+	t.Cleanup(func() { pterm.SetDefaultOutput(os.Stdout) })
+
+	o := newTUIObserver(NewParameters(), false)
+
+	server := api.Server{Name: "lhr1"}
+	server.Location.City, server.Location.Country = "London", "GB"
+
+	o.OnPhaseStart(zoomies.PhaseDownload, &zoomies.Target{Server: server})
+	for _, b := range []uint64{1_000_000, 3_000_000} {
+		o.OnSample(zoomies.PhaseDownload, zoomies.Sample{Elapsed: time.Second, Bytes: b, Connections: 4})
+	}
+	o.OnSample(zoomies.PhaseDownload, zoomies.Sample{RTT: 42 * time.Millisecond, Method: api.ProbeTCP})
+	o.OnSample(zoomies.PhaseDownload, zoomies.Sample{Lost: true})
+	o.OnWarning("download: connection reset")
+
+	assert.Equal(t, len(area.frames), 6)
+	got := pterm.RemoveColorFromString(area.frames[len(area.frames)-1])
+	for _, want := range []string{"London, GB", "Running the download test", "Connections: 4", "24.00 Mbps", "3.00 MB", "42.0 ms (lost 1)", "Not started", "download: connection reset"} {
+		assert.Assert(t, strings.Contains(got, want), "%q is missing from the dashboard:\n%s", want, got)
+	}
+
+	// The dashboard is closed before the summary is printed.
+	assert.Equal(t, summary.Len(), 0)
+	o.finish(&zoomies.Report{Result: api.Result{Server: server, Latency: &api.LatencyResult{Ping: 12 * time.Millisecond}}})
+	assert.Assert(t, area.stopped)
+
+	got = pterm.RemoveColorFromString(summary.String())
+	for _, want := range []string{"zoomies", "Server             London, GB", "Ping               12ms"} {
+		assert.Assert(t, strings.Contains(got, want), "%q is missing from the summary:\n%s", want, got)
+	}
+}
+
+func TestRenderSummary(t *testing.T) {
+	report := &zoomies.Report{Result: api.Result{
+		Server:   api.Server{Name: "lhr1"},
+		Latency:  &api.LatencyResult{Ping: 12 * time.Millisecond, Method: api.ProbeICMP},
+		Download: &api.TransferResult{Bytes: 12_500_000, Duration: time.Second, LoadedLatency: &api.LatencyResult{Ping: 80 * time.Millisecond}},
+		Retries:  2,
+	}}
+
+	got := renderSummary(report, false)
+
+	assert.Assert(t, strings.Contains(got, "Ping               12ms (jitter: 0s, loss: 0.0%, icmp)"), got)
+	assert.Assert(t, strings.Contains(got, "Download           100.00 Mbps"), got)
+	assert.Assert(t, strings.Contains(got, "Download latency   80ms"), got)
+	assert.Assert(t, strings.Contains(got, "Retries            2"), got)
+	assert.Assert(t, !strings.Contains(got, "Upload"), got)
+}
@@ -1,30 +1,27 @@
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
-	"sort"
+	"os"
 	"time"
 
 	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/cache"
+	"github.com/primlock/zoomies/internal/compare"
+	"github.com/primlock/zoomies/internal/config"
+	"github.com/primlock/zoomies/internal/history"
 	"github.com/primlock/zoomies/internal/logger"
-	"github.com/pterm/pterm"
+	"github.com/primlock/zoomies/internal/nagios"
+	"github.com/primlock/zoomies/internal/retry"
+	"github.com/primlock/zoomies/internal/sink"
+	"github.com/primlock/zoomies/zoomies"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-type RemoteServerResponse struct {
-	Client  api.Client   `json:"client"`
-	Targets []api.Server `json:"targets"`
-}
-
-type Candidate struct {
-	Server api.Server
-	RTT    time.Duration
-}
-
 type Parameters struct {
 	// The endpoint used to gather testing server information.
 	APIEndpointToken string
@@ -38,11 +35,115 @@ type Parameters struct {
 	// Configurations that apply to download, upload and latency tests.
 	Config *TestConfig
 
-	// Provide additional information to the user from the logger
+	// Log at the debug level, whatever the log level.
 	Verbose bool
+
+	// The lowest level of the records that are logged: debug, info, warn or error.
+	LogLevel string
+
+	// The format the records are logged in: text or json.
+	LogFormat string
+
+	// The file the records are appended to instead of stderr.
+	LogFile string
+
+	// Show a full-screen dashboard while the test runs instead of a spinner.
+	TUI bool
+
+	// Print the results alone, without the progress of the run.
+	Quiet bool
+
+	// Print without colors and styling.
+	NoColor bool
+
+	// The file the api endpoint token and server list are cached in.
+	CacheFile string
+
+	// How long a discovered token and a fetched server list are reused for. Zero disables caching.
+	TokenTTL      time.Duration
+	ServerListTTL time.Duration
+
+	// A file listing the servers to test against instead of discovering them through fast.com.
+	ServersFile string
+
+	// A file the server list discovered through fast.com is saved to for replay.
+	Record string
+
+	// The number of times a failed request or expired transfer is retried.
+	Retries int
+
+	// Which of the discovered servers are tested and how they are ranked.
+	Selection *zoomies.Selection
+
+	// The config file the settings are read from.
+	ConfigFile string
+
+	// The named profile of settings applied on top of the config file.
+	Profile string
+
+	// The base URL of a Prometheus Pushgateway that the results are pushed to after the run.
+	PushgatewayURL string
+
+	// The job name the pushed metrics are grouped under.
+	PushgatewayJob string
+
+	// Additional grouping labels attached to the pushed metrics.
+	PushgatewayLabels map[string]string
+
+	// The base URL of an OpenTelemetry collector that receives the results over OTLP/HTTP.
+	OTLPEndpoint string
+
+	// Additional headers sent with each OTLP request.
+	OTLPHeaders map[string]string
+
+	// Where the results are written in InfluxDB line protocol: an http(s) write endpoint, "-" for stdout or a file.
+	InfluxDestination string
+
+	// The token used to authenticate with an InfluxDB write endpoint.
+	InfluxToken string
+
+	// The host:port of a StatsD daemon that receives the results as gauges.
+	StatsDAddr string
+
+	// The prefix prepended to each StatsD gauge name.
+	StatsDPrefix string
+
+	// Attach the client and server attributes to each gauge as DogStatsD tags.
+	StatsDTags bool
+
+	// The file the results of every run are kept in.
+	HistoryFile string
+
+	// The option to skip saving the results to the history.
+	NoHistory bool
+
+	// The format the result is printed in: text, json or nagios.
+	Output string
+
+	// A result file or history id that the result is compared against.
+	Baseline string
+
+	// The percentage a metric may get worse by compared to the baseline before it is a regression.
+	Tolerance float64
+
+	// The lowest acceptable download and upload rates, e.g. 100Mbps.
+	MinDownload string
+	MinUpload   string
+
+	// The highest acceptable latency, e.g. 30ms.
+	MaxLatency string
+
+	// The highest acceptable packet loss, e.g. 1%.
+	MaxLoss string
+
+	// The warning and critical thresholds of the nagios output keyed by check name, e.g.
+	// download=100Mbps.
+	Warning  map[string]string
+	Critical map[string]string
 }
 
 type TestConfig struct {
+	// The time in seconds the whole run may take.
 	Timeout int
 
 	// The amount of time the download and upload test runs for in seconds
@@ -54,32 +155,48 @@ type TestConfig struct {
 	// The number of concurrent HTTP request being made to download and upload
 	ConcurrentRequests int
 
+	// The number of bytes requested by each download request
+	ChunkSize int64
+
+	// The number of bytes sent by each upload request
+	UploadPayloadSize int
+
+	// The number of servers with the lowest round-trip time that are kept as candidates
+	ServerCount int
+
 	// Determines whether the unit prefixes are displayed as decimal (Mbps) or binary (Mibit/s)
 	BinaryUnitPrefix bool
 }
 
+// The errors of the run are defined by the zoomies package.
 var (
-	ErrUnknownAppToken      = errors.New("invalid token passed as a parameter")
-	ErrDurationOutOfBounds  = errors.New("duration must be in the range 3-30 inclusive")
-	ErrPingCountOutOfBounds = errors.New("ping must be in the range 1-5 inclusive")
-	ErrNoCandidatesToRank   = errors.New("the candidates object supplied was nil")
+	ErrUnknownAppToken        = zoomies.ErrUnknownAppToken
+	ErrDurationOutOfBounds    = zoomies.ErrDurationOutOfBounds
+	ErrPingCountOutOfBounds   = zoomies.ErrPingCountOutOfBounds
+	ErrTimeoutOutOfBounds     = zoomies.ErrTimeoutOutOfBounds
+	ErrConnectionsOutOfBounds = zoomies.ErrConnectionsOutOfBounds
+	ErrChunkSizeOutOfBounds   = zoomies.ErrChunkSizeOutOfBounds
+	ErrUploadSizeOutOfBounds  = zoomies.ErrUploadSizeOutOfBounds
+	ErrServerCountOutOfBounds = zoomies.ErrServerCountOutOfBounds
+	ErrRetriesOutOfBounds     = zoomies.ErrRetriesOutOfBounds
+	ErrRecordWithServersFile  = zoomies.ErrRecordWithServersFile
 )
 
-var log = logger.TLog
-
 const (
 	CommandName               = "zoomies"
 	CommandDescription        = "zoomies is a network speed measurement tool"
-	UploadTestPayloadSize     = 25 * 1024 * 1024 // 25 MB
-	DefaultTestServerCount    = 5
+	UploadTestPayloadSize     = zoomies.DefaultUploadSize
+	DefaultTestServerCount    = zoomies.DefaultServerCount
 	DefaultNoDownload         = false
 	DefaultNoUpload           = false
-	DefaultTimeout            = 30
-	DefaultDuration           = 15
-	DefaultPingCount          = 3
-	DefaultConcurrentRequests = 3
-	DefaultChunkSize          = 26214400
+	DefaultTimeout            = int(zoomies.DefaultTimeout / time.Second)
+	DefaultDuration           = int(zoomies.DefaultDuration / time.Second)
+	DefaultPingCount          = zoomies.DefaultPings
+	DefaultConcurrentRequests = zoomies.DefaultConnections
+	DefaultChunkSize          = zoomies.DefaultChunkSize
 	DefaultBinaryUnitPrefix   = false
+	DefaultTokenTTL           = zoomies.DefaultTokenTTL
+	DefaultServerListTTL      = zoomies.DefaultServerListTTL
 )
 
 func NewTestConfig() *TestConfig {
@@ -88,16 +205,36 @@ func NewTestConfig() *TestConfig {
 		Duration:           DefaultDuration,
 		PingCount:          DefaultPingCount,
 		ConcurrentRequests: DefaultConcurrentRequests,
+		ChunkSize:          DefaultChunkSize,
+		UploadPayloadSize:  UploadTestPayloadSize,
+		ServerCount:        DefaultTestServerCount,
 		BinaryUnitPrefix:   DefaultBinaryUnitPrefix,
 	}
 }
 
 func NewParameters() *Parameters {
+	selection := zoomies.DefaultSelection()
+
 	return &Parameters{
 		NoDownload: DefaultNoDownload,
 		NoUpload:   DefaultNoUpload,
 		Config:     NewTestConfig(),
 		Verbose:    false,
+		LogLevel:   logger.DefaultLevel,
+		LogFormat:  logger.DefaultFormat,
+		ConfigFile: config.DefaultPath(),
+		Retries:    retry.DefaultRetries,
+		Selection:  &selection,
+
+		CacheFile:     cache.DefaultPath(),
+		TokenTTL:      DefaultTokenTTL,
+		ServerListTTL: DefaultServerListTTL,
+
+		PushgatewayJob: sink.DefaultPushgatewayJob,
+		StatsDPrefix:   sink.DefaultStatsDPrefix,
+		HistoryFile:    history.DefaultPath(),
+		Output:         DefaultOutput,
+		Tolerance:      compare.DefaultTolerance,
 	}
 }
 
@@ -111,14 +248,29 @@ func NewCmd() *cobra.Command {
 	}
 
 	// Define the user provided params.
-	cmd.Flags().StringVarP(&params.APIEndpointToken, "token", "t", "", "user provided api endpoint access token")
-	cmd.Flags().BoolVar(&params.NoDownload, "nodownload", params.NoDownload, "skip the download test")
-	cmd.Flags().BoolVar(&params.NoUpload, "noupload", params.NoUpload, "skip the upload test")
+	addRunFlags(cmd.Flags(), params)
+	cmd.PersistentFlags().StringVar(&params.HistoryFile, "history-file", params.HistoryFile, "the file the results of every run are kept in")
+	cmd.PersistentFlags().StringVar(&params.ConfigFile, ConfigFlagName, params.ConfigFile, "the config file the settings are read from")
+	cmd.PersistentFlags().StringVar(&params.Profile, ProfileFlagName, "", "a named profile of settings to apply (e.g. quick or thorough)")
+	cmd.PersistentFlags().StringVar(&params.CacheFile, "cache-file", params.CacheFile, "the file the api endpoint token and server list are cached in")
+	cmd.PersistentFlags().BoolVarP(&params.Quiet, "quiet", "q", params.Quiet, "print the results alone, without the progress")
+	cmd.PersistentFlags().BoolVar(&params.NoColor, "no-color", params.NoColor, "print without colors (also set by NO_COLOR or when stdout is not a terminal)")
+	cmd.PersistentFlags().StringVar(&params.LogLevel, "log-level", params.LogLevel, "the lowest level of the records that are logged (debug, info, warn or error)")
+	cmd.PersistentFlags().StringVar(&params.LogFormat, "log-format", params.LogFormat, "the format the records are logged in (text or json)")
+	cmd.PersistentFlags().StringVar(&params.LogFile, "log-file", "", "append the records to this file instead of writing them to stderr")
+	config.Mark(cmd.PersistentFlags(), "history-file", "cache-file", "quiet", "no-color", "log-level", "log-format", "log-file")
+
+	// Fill in the flags not given on the command line from the config file and environment.
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(cmd, params); err != nil {
+			return err
+		}
+
+		setupColor(params)
+		return setupLogger(cmd, params)
+	}
 
-	cmd.Flags().IntVarP(&params.Config.Duration, "duration", "d", params.Config.Duration, "the length of time the test should run for (3-30 seconds)")
-	cmd.Flags().IntVarP(&params.Config.PingCount, "pings", "p", params.Config.PingCount, "the number of pings sent to the server in the latency test (1-5)")
-	cmd.Flags().BoolVarP(&params.Config.BinaryUnitPrefix, "binary", "b", params.Config.BinaryUnitPrefix, "display the unit prefixes in binary (Mibit/s) instead of decimal (Mbps)")
-	cmd.Flags().BoolVar(&params.Verbose, "verbose", params.Verbose, "provide additional information from the logger")
+	cmd.AddCommand(newDaemonCmd(params), newHistoryCmd(params), newTrendsCmd(params), newCompareCmd(params), newServersCmd(params))
 
 	// Set the function to execute the logic.
 	cmd.RunE = cmdRunE(params)
@@ -126,215 +278,316 @@ func NewCmd() *cobra.Command {
 	return cmd
 }
 
+// addRunFlags defines the flags that configure a test run on the flag set.
+func addRunFlags(fs *pflag.FlagSet, params *Parameters) {
+	fs.StringVarP(&params.APIEndpointToken, "token", "t", "", "user provided api endpoint access token")
+	fs.DurationVar(&params.TokenTTL, "token-ttl", params.TokenTTL, "how long a discovered api endpoint token is cached for (0 disables the cache)")
+	fs.StringVar(&params.ServersFile, "servers-file", "", "test against the servers in this file (a recorded response or a list of urls) instead of asking fast.com")
+	fs.StringVar(&params.Record, "record", "", "save the server list discovered through fast.com to this file for use with --servers-file")
+	fs.IntVar(&params.Retries, "retries", params.Retries, "the number of times a failed request or expired transfer is retried (0-10)")
+	fs.DurationVar(&params.ServerListTTL, "server-list-ttl", params.ServerListTTL, "how long the server list is cached for (0 disables the cache)")
+	fs.BoolVar(&params.NoDownload, "nodownload", params.NoDownload, "skip the download test")
+	fs.BoolVar(&params.NoUpload, "noupload", params.NoUpload, "skip the upload test")
+
+	fs.IntVarP(&params.Config.Duration, "duration", "d", params.Config.Duration, "the length of time the test should run for (3-30 seconds)")
+	fs.IntVarP(&params.Config.PingCount, "pings", "p", params.Config.PingCount, "the number of pings sent to the server in the latency test (1-5)")
+	fs.BoolVarP(&params.Config.BinaryUnitPrefix, "binary", "b", params.Config.BinaryUnitPrefix, "display the unit prefixes in binary (Mibit/s) instead of decimal (Mbps)")
+	fs.BoolVar(&params.Verbose, "verbose", params.Verbose, "log at the debug level (same as --log-level=debug)")
+	fs.BoolVar(&params.TUI, "tui", params.TUI, "show a full-screen dashboard of the throughput and latency under load while the test runs")
+	fs.IntVar(&params.Config.Timeout, "timeout", params.Config.Timeout, "the time in seconds the whole run may take before it is stopped")
+	fs.IntVarP(&params.Config.ConcurrentRequests, "connections", "c", params.Config.ConcurrentRequests, "the number of parallel connections used in the download and upload tests (1-32)")
+	fs.Int64Var(&params.Config.ChunkSize, "chunk-size", params.Config.ChunkSize, "the number of bytes requested by each download request")
+	fs.IntVar(&params.Config.UploadPayloadSize, "upload-size", params.Config.UploadPayloadSize, "the number of bytes sent by each upload request")
+	fs.IntVar(&params.Config.ServerCount, "servers", params.Config.ServerCount, "the number of nearest servers kept as test candidates (1-20)")
+	fs.StringVar(&params.Selection.Pin, "server", "", "always test this server, given by name, host or its 1-based index in the server list")
+	fs.StringSliceVar(&params.Selection.Countries, "country", nil, "only test servers in these countries")
+	fs.StringSliceVar(&params.Selection.Cities, "city", nil, "only test servers in these cities")
+	fs.StringSliceVar(&params.Selection.Exclude, "exclude", nil, "never test the servers with these names or hosts")
+	fs.StringVar(&params.Selection.Rank, "rank", params.Selection.Rank, "how the candidates are ranked (rtt or throughput)")
+	fs.IntVar(&params.Selection.RankSamples, "rank-samples", params.Selection.RankSamples, "the number of probes each candidate's median round-trip time is taken over (1-10)")
+
+	fs.StringVar(&params.PushgatewayURL, "pushgateway", "", "push the results to the prometheus pushgateway at this url")
+	fs.StringVar(&params.PushgatewayJob, "pushgateway-job", params.PushgatewayJob, "the job name the pushed metrics are grouped under")
+	fs.StringToStringVar(&params.PushgatewayLabels, "pushgateway-label", nil, "grouping labels for the pushed metrics (e.g. instance=edge1,site=lon)")
+	fs.StringVar(&params.OTLPEndpoint, "otlp-endpoint", "", "export the results as otlp/http metrics and traces to this collector url")
+	fs.StringToStringVar(&params.OTLPHeaders, "otlp-header", nil, "headers sent with each otlp request (e.g. authorization=token)")
+	fs.StringVar(&params.InfluxDestination, "influx", "", "write the results in influxdb line protocol to an http(s) write url, a file or - for stdout in place of the results")
+	fs.StringVar(&params.InfluxToken, "influx-token", "", "the token used to authenticate with the influxdb write url")
+	fs.StringVar(&params.StatsDAddr, "statsd", "", "send the results as gauges to the statsd daemon at this host:port")
+	fs.StringVar(&params.StatsDPrefix, "statsd-prefix", params.StatsDPrefix, "the prefix prepended to each statsd gauge name")
+	fs.BoolVar(&params.StatsDTags, "statsd-tags", false, "attach the client and server locations to each gauge as dogstatsd tags")
+	fs.BoolVar(&params.NoHistory, "no-history", params.NoHistory, "skip saving the results to the history")
+
+	fs.StringVarP(&params.Output, "output", "o", params.Output, "the format the result is printed in (text, json or nagios)")
+	fs.StringVar(&params.Baseline, "baseline", "", "a result file or history id to compare the result against")
+	fs.Float64Var(&params.Tolerance, "tolerance", params.Tolerance, "the percentage a metric may get worse by compared to the baseline before it is a regression")
+
+	fs.StringVar(&params.MinDownload, "min-download", "", "fail when the download rate is below this (e.g. 100Mbps)")
+	fs.StringVar(&params.MinUpload, "min-upload", "", "fail when the upload rate is below this (e.g. 20Mbps)")
+	fs.StringVar(&params.MaxLatency, "max-latency", "", "fail when the latency is above this (e.g. 30ms)")
+	fs.StringVar(&params.MaxLoss, "max-loss", "", "fail when the packet loss is above this (e.g. 1%)")
+	fs.StringToStringVar(&params.Warning, "warning", nil, "the nagios warning thresholds (e.g. download=100Mbps,latency=30ms,loss=1%)")
+	fs.StringToStringVar(&params.Critical, "critical", nil, "the nagios critical thresholds (default the --min and --max flags)")
+
+	config.Mark(fs)
+}
+
 // cmdRunE executes the logic of the command line application.
 func cmdRunE(params *Parameters) func(cmd *cobra.Command, args []string) error {
 	return func(cmd *cobra.Command, args []string) error {
-		err := cmdValidateE(params)
-		if err != nil {
-			return err
+		if params.Output == OutputNagios {
+			return runNagios(cmd, params)
 		}
 
-		if params.Verbose {
-			log.Verbose()
+		if err := prepareRun(cmd, params); err != nil {
+			return err
 		}
 
-		log.Info(
-			"token: %s, nodownload: %v, noupload: %v, duration: %d, binary: %v, verbose: %v\n",
-			params.APIEndpointToken,
-			params.NoDownload,
-			params.NoUpload,
-			params.Config.Duration,
-			params.Config.BinaryUnitPrefix,
-			params.Verbose,
-		)
-
-		resp, err := getRemoteServerList(params.APIEndpointToken)
+		thresholds, err := parseThresholds(params)
 		if err != nil {
 			return err
 		}
 
-		pterm.DefaultBasicText.Printf("Testing from Origin: %s — %s, %s [%s]\n", resp.Client.ISP, resp.Client.Location.City, resp.Client.Location.Country, resp.Client.IP)
+		var baseline *api.Result
+		if params.Baseline != "" {
+			baseline, err = loadResult(params, params.Baseline)
+			if err != nil {
+				return err
+			}
+		}
 
-		servers, err := getLowestRTTServers(resp.Targets, DefaultTestServerCount, api.ICMPProbe)
+		sinks, err := newSinks(params, cmd.OutOrStdout())
 		if err != nil {
 			return err
 		}
 
-		err = runTestSuite(params, servers)
-		if err != nil {
+		result, err := runOnce(cmd.Context(), params)
+		if errors.Is(err, zoomies.ErrAborted) && result != nil {
+			// The partial results are printed, but not recorded or checked.
+			return errors.Join(writeOutput(cmd.OutOrStdout(), params, result), err)
+		} else if err != nil {
 			return err
 		}
 
-		return nil
+		errSinks := writeSinks(cmd.Context(), sinks, result)
+
+		if err := writeOutput(cmd.OutOrStdout(), params, result); err != nil {
+			return err
+		}
+
+		errThresholds := checkThresholds(thresholds, result, params.Config.BinaryUnitPrefix)
+
+		return errors.Join(errThresholds, errSinks, checkBaseline(params, baseline, result))
 	}
 }
 
-// cmdValidateE validates the parameters the users passes on the command line.
-func cmdValidateE(params *Parameters) error {
-	if params.Config.Duration < 3 || params.Config.Duration > 30 {
-		return ErrDurationOutOfBounds
+// prepareRun validates the parameters and prepares the output of a run.
+func prepareRun(cmd *cobra.Command, params *Parameters) error {
+	if err := cmdValidateE(params); err != nil {
+		return err
 	}
 
-	if params.Config.PingCount < 1 || params.Config.PingCount > 5 {
-		return ErrPingCountOutOfBounds
-	}
+	logger.FromContext(cmd.Context()).Debug("starting a run",
+		"token_given", params.APIEndpointToken != "",
+		"nodownload", params.NoDownload,
+		"noupload", params.NoUpload,
+		"duration", params.Config.Duration,
+		"binary", params.Config.BinaryUnitPrefix,
+	)
 
-	return nil
+	return setupOutput(params)
 }
 
-// getRemoteServerList gets a list of servers from a remote URL.
-func getRemoteServerList(token string) (*RemoteServerResponse, error) {
-	// Dynamically retrieve the endpoint token
-	if token == "" {
-		log.Warn("no token found in provided params; getting api endpoint token\n")
-		t, err := api.GetAPIEndpointToken()
-		if err != nil {
-			return nil, err
-		}
+// runNagios runs the test as a nagios check plugin. Every outcome is reported as a single status
+// line on stdout and the exit code, so invalid flags and a failed run are UNKNOWN rather than an
+// error.
+func runNagios(cmd *cobra.Command, params *Parameters) error {
+	cmd.SilenceErrors = true
+
+	err := checkNagios(cmd, params)
 
-		token = t
+	var exit *ExitCodeError
+	if err != nil && !errors.As(err, &exit) {
+		fmt.Fprintln(cmd.OutOrStdout(), nagios.UnknownLine(err))
+		return &ExitCodeError{Code: int(nagios.Unknown), Err: err}
 	}
 
-	// Query the remote for the JSON list of the nearest servers
-	resp, err := http.Get(fmt.Sprintf("%s?token=%s&https=true", api.FastSpeedTestServerURL, token))
-	if err != nil {
-		return nil, err
+	return err
+}
+
+// checkNagios runs the test and prints the status line of the result against the nagios thresholds.
+func checkNagios(cmd *cobra.Command, params *Parameters) error {
+	if err := prepareRun(cmd, params); err != nil {
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusForbidden {
-		log.Error("GET request made to %s?token=%s&https=true returned status code %d\n", api.FastSpeedTestServerURL, token, resp.StatusCode)
-		return nil, ErrUnknownAppToken
+	warning, critical, err := nagiosThresholds(params)
+	if err != nil {
+		return err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	sinks, err := newSinks(params, cmd.OutOrStdout())
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Convert the remote response into a JSON object.
-	var remote RemoteServerResponse
-	err = json.Unmarshal(body, &remote)
+	result, err := runOnce(cmd.Context(), params)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &remote, nil
+	if err := writeSinks(cmd.Context(), sinks, result); err != nil {
+		logger.FromContext(cmd.Context()).Error("failed to write the results", "error", err)
+	}
+
+	return writeNagios(cmd.OutOrStdout(), result, warning, critical)
 }
 
-// getLowestRTTServers determines the testing servers by evaluating the lowest round-trip times (RTT).
-// The number of servers returned is limited by 'count' and the type of probe is determined by 'pf'.
-func getLowestRTTServers(candidates []api.Server, count int, pf api.ProbeFunc) ([]api.Server, error) {
-	if len(candidates) == 0 {
-		return []api.Server{}, ErrNoCandidatesToRank
-	} else if len(candidates) < count {
-		log.Warn("number of candidates was less than the count parameter\n")
-		count = len(candidates)
+// runOnce runs the test suite with the parameters, showing its progress with a spinner or the
+// dashboard. Key presses control the run when stdin is a terminal; when it is aborted, the partial
+// results are returned with zoomies.ErrAborted.
+func runOnce(ctx context.Context, params *Parameters) (*api.Result, error) {
+	log := logger.FromContext(ctx)
+
+	control := zoomies.NewControl()
+	stop, keys := listenKeys(ctx, control)
+	defer stop()
+
+	var observer runObserver = newTextObserver(params, keys)
+	if params.TUI {
+		// The dashboard is drawn on stdout.
+		if isTerminal(os.Stdout) {
+			observer = newTUIObserver(params, keys)
+		} else {
+			log.Warn("stdout is not a terminal; showing the progress as text instead of the dashboard")
+		}
 	}
 
-	// Get the RTT of each server and store it in our Candidate struct for sorting.
-	s := make([]Candidate, 0, len(candidates))
-	for i := 0; i < len(candidates); i++ {
-		rtt, err := pf(candidates[i], 1)
-		if err != nil {
-			return []api.Server{}, err
-		}
+	opts := params.options()
+	opts.Observer = observer
+	opts.Control = control
+	opts.Logger = log
+
+	report, err := zoomies.Run(ctx, opts)
+	observer.finish(report)
+	if err != nil && report == nil {
+		return nil, err
+	}
+
+	return &report.Result, err
+}
 
-		s = append(s, Candidate{Server: candidates[i], RTT: rtt})
-		log.Info("server in %s, %s reported a ping of %s\n", candidates[i].Location.City, candidates[i].Location.Country, (rtt.Round(time.Millisecond)))
+// options returns the options of a run with the parameters.
+func (params *Parameters) options() zoomies.Options {
+	return zoomies.Options{
+		Token:         params.APIEndpointToken,
+		CacheFile:     params.CacheFile,
+		TokenTTL:      params.TokenTTL,
+		ServerListTTL: params.ServerListTTL,
+		ServersFile:   params.ServersFile,
+		Record:        params.Record,
+		Retries:       params.Retries,
+		Timeout:       time.Duration(params.Config.Timeout) * time.Second,
+		Duration:      time.Duration(params.Config.Duration) * time.Second,
+		Pings:         params.Config.PingCount,
+		Connections:   params.Config.ConcurrentRequests,
+		ChunkSize:     params.Config.ChunkSize,
+		UploadSize:    params.Config.UploadPayloadSize,
+		Servers:       params.Config.ServerCount,
+		NoDownload:    params.NoDownload,
+		NoUpload:      params.NoUpload,
+		LoadedLatency: params.TUI,
+		Selection:     *params.Selection,
 	}
+}
 
-	// Sort by RTT (ascending).
-	sort.Slice(s, func(i, j int) bool {
-		return s[i].RTT < s[j].RTT
-	})
+// cmdValidateE validates the parameters the users passes on the command line.
+func cmdValidateE(params *Parameters) error {
+	if params.Tolerance < 0 {
+		return ErrToleranceOutOfRange
+	}
 
-	// Hold only the top N lowest RTT servers.
-	servers := make([]api.Server, count)
-	for i := 0; i < count; i++ {
-		servers[i] = s[i].Server
+	if params.Quiet && params.TUI {
+		return ErrQuietWithTUI
 	}
 
-	return servers, nil
+	opts := params.options()
+	return opts.Validate()
 }
 
-func runTestSuite(params *Parameters, servers []api.Server) error {
-	for i, s := range servers {
-		ip, err := s.GetIPv4()
+// newSinks creates the destinations the results are written to from the parameters. The line
+// protocol of --influx - is written to stdout.
+func newSinks(params *Parameters, stdout io.Writer) ([]sink.Sink, error) {
+	var sinks []sink.Sink
+
+	if !params.NoHistory {
+		store, err := history.Open(params.HistoryFile)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		pterm.DefaultBasicText.Printf("Testing Server: %s, %s [%s]\n", s.Location.City, s.Location.Country, ip)
-
-		runLatencyTest(s, params.Config.PingCount)
+		sinks = append(sinks, store)
+	}
 
-		if params.NoDownload {
-			pterm.DefaultBasicText.Printf(" %s  Download test is disabled\n", pterm.ThemeDefault.Checkmark.Unchecked)
-		} else {
-			if err := runDownloadTest(s, params.Config.ConcurrentRequests, params.Config.Duration, DefaultChunkSize, params.Config.BinaryUnitPrefix); err != nil {
-				return err
-			}
+	if params.PushgatewayURL != "" {
+		p, err := sink.NewPushgateway(params.PushgatewayURL, params.PushgatewayJob, params.PushgatewayLabels)
+		if err != nil {
+			return nil, err
 		}
 
-		if params.NoUpload {
-			pterm.DefaultBasicText.Printf(" %s  Upload test is disabled\n", pterm.ThemeDefault.Checkmark.Unchecked)
-		} else {
-			if err := runUploadTest(s, params.Config.ConcurrentRequests, params.Config.Duration, params.Config.BinaryUnitPrefix); err != nil {
-				return err
-			}
-		}
+		sinks = append(sinks, p)
+	}
 
-		if i < len(servers)-1 {
-			pterm.DefaultBasicText.Printf("\n")
+	if params.OTLPEndpoint != "" {
+		o, err := sink.NewOTLP(params.OTLPEndpoint, params.OTLPHeaders)
+		if err != nil {
+			return nil, err
 		}
 
-		// Test only the first server for right now. Intention is to test nearest 3 at the same time and record the results.
-		if true {
-			break
-		}
+		sinks = append(sinks, o)
 	}
 
-	return nil
-}
+	if params.InfluxDestination != "" {
+		i := sink.NewInflux(params.InfluxDestination, params.InfluxToken)
+		i.Stdout = stdout
 
-// runLatencyTest performs the latency test that measures server ping.
-func runLatencyTest(server api.Server, pings int) error {
-	err := server.Latency(pings)
-	if err != nil {
-		return err
+		sinks = append(sinks, i)
 	}
 
-	return nil
+	if params.StatsDAddr != "" {
+		s, err := sink.NewStatsD(params.StatsDAddr, params.StatsDPrefix, params.StatsDTags)
+		if err != nil {
+			return nil, err
+		}
+
+		sinks = append(sinks, s)
+	}
+
+	return sinks, nil
 }
 
-// runDownloadTest performs the download speed test that measures the download rate in Mbps.
-func runDownloadTest(server api.Server, requests, duration int, chunk int64, binary bool) error {
-	err := server.SetChunkSize(chunk)
-	if err != nil {
-		return fmt.Errorf("failed to append chunk size: %s", err)
+// writeSinks writes the result to each of the sinks, returning the errors of any that failed.
+func writeSinks(ctx context.Context, sinks []sink.Sink, result *api.Result) error {
+	if result == nil {
+		return nil
 	}
 
-	err = server.Download(requests, chunk, time.Duration(duration)*time.Second, binary)
-	if err != nil {
-		return err
+	var errs []error
+	for _, s := range sinks {
+		if err := s.Write(ctx, result); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
-// runDownloadTest performs the upload speed test that generates a payload to send to the server
-// and measures it's upload rate in Mbps.
-func runUploadTest(server api.Server, requests, duration int, binary bool) error {
-	payload, err := api.GeneratePayload(UploadTestPayloadSize)
-	if err != nil {
-		return err
-	}
-
-	err = server.Upload(requests, time.Duration(duration)*time.Second, payload, binary)
-	if err != nil {
-		return err
+// serverLocation describes where the server is, falling back to its name for servers listed in a
+// servers file without a location.
+func serverLocation(s api.Server) string {
+	if s.Location.City == "" && s.Location.Country == "" {
+		return s.Name
 	}
 
-	return nil
+	return fmt.Sprintf("%s, %s", s.Location.City, s.Location.Country)
 }
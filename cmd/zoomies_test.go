@@ -3,11 +3,12 @@ package cmd
 import (
 	"bytes"
 	"fmt"
-	"reflect"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
-	"time"
 
-	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/logger"
 	"gotest.tools/v3/assert"
 )
 
@@ -36,74 +37,6 @@ func TestBadToken(t *testing.T) {
 	}
 }
 
-var mockRTT time.Duration = 20
-
-func mockProbeFunc(server api.Server, count int) (time.Duration, error) {
-	mockRTT += 20
-	return mockRTT, nil
-}
-
-func TestGetLowestRTTServers(t *testing.T) {
-	testCases := []struct {
-		name       string
-		candidates []api.Server
-		count      int
-		probeFunc  api.ProbeFunc
-		expected   []string
-		err        error
-	}{
-		{
-			name: "Top 2 servers with the lowest rtt",
-			candidates: []api.Server{
-				{Name: "server1"},
-				{Name: "server2"},
-				{Name: "server3"},
-			},
-			count:     2,
-			probeFunc: mockProbeFunc,
-			expected:  []string{"server1", "server2"},
-			err:       nil,
-		},
-		{
-			name: "Request more servers than available",
-			candidates: []api.Server{
-				{Name: "server1"},
-				{Name: "server2"},
-			},
-			count:     4,
-			probeFunc: mockProbeFunc,
-			expected:  []string{"server1", "server2"},
-			err:       nil,
-		},
-		{
-			name:       "Empty list of servers passed",
-			candidates: []api.Server{},
-			count:      4,
-			probeFunc:  mockProbeFunc,
-			expected:   []string{},
-			err:        ErrNoCandidatesToRank,
-		},
-	}
-
-	for _, tt := range testCases {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := getLowestRTTServers(tt.candidates, tt.count, tt.probeFunc)
-			if err != nil {
-				assert.Error(t, err, tt.err.Error())
-			}
-
-			names := make([]string, len(got))
-			for i, server := range got {
-				names[i] = server.Name
-			}
-
-			if !reflect.DeepEqual(names, tt.expected) {
-				t.Errorf("got %v, want %v", names, tt.expected)
-			}
-		})
-	}
-}
-
 func TestDurationOutOfBounds(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -155,3 +88,85 @@ func TestPingCountOutOfBounds(t *testing.T) {
 		})
 	}
 }
+
+func TestTestConfigOutOfBounds(t *testing.T) {
+	testCases := []struct {
+		name     string
+		arg      string
+		expected error
+	}{
+		{name: "Timeout below the lower boundary", arg: "--timeout=0", expected: ErrTimeoutOutOfBounds},
+		{name: "Connections below the lower boundary", arg: "--connections=0", expected: ErrConnectionsOutOfBounds},
+		{name: "Connections above the upper boundary", arg: "--connections=64", expected: ErrConnectionsOutOfBounds},
+		{name: "Chunk size below the lower boundary", arg: "--chunk-size=100", expected: ErrChunkSizeOutOfBounds},
+		{name: "Upload size above the upper boundary", arg: "--upload-size=2147483647", expected: ErrUploadSizeOutOfBounds},
+		{name: "Server count above the upper boundary", arg: "--servers=50", expected: ErrServerCountOutOfBounds},
+		{name: "Retries below the lower boundary", arg: "--retries=-1", expected: ErrRetriesOutOfBounds},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCmd()
+
+			c.SetOutput(&bytes.Buffer{})
+			c.SetArgs([]string{tt.arg})
+
+			got := c.Execute()
+
+			assert.Error(t, got, tt.expected.Error())
+		})
+	}
+}
+
+func TestRecordWithServersFile(t *testing.T) {
+	c := NewCmd()
+
+	c.SetOutput(&bytes.Buffer{})
+	c.SetArgs([]string{"--servers-file=a.json", "--record=b.json"})
+
+	assert.ErrorIs(t, c.Execute(), ErrRecordWithServersFile)
+}
+
+func TestLogFlags(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected error
+		logged   string
+	}{
+		{name: "Unknown level", args: []string{"--log-level=verbose"}, expected: logger.ErrUnknownLevel},
+		{name: "Unknown format", args: []string{"--log-format=xml"}, expected: logger.ErrUnknownFormat},
+		{name: "JSON records in the log file", args: []string{"--log-level=debug", "--log-format=json"}, logged: `"msg":"starting a run"`},
+		{name: "Verbose logs at the debug level", args: []string{"--verbose"}, logged: `msg="starting a run"`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			file := filepath.Join(dir, "zoomies.log")
+
+			c := NewCmd()
+
+			// The missing servers file stops the run right after it starts.
+			c.SetOutput(&bytes.Buffer{})
+			c.SetArgs(append([]string{
+				"--log-file=" + file,
+				"--servers-file=" + filepath.Join(dir, "missing.json"),
+				"--no-history",
+			}, tt.args...))
+
+			got := c.Execute()
+
+			if tt.expected != nil {
+				assert.ErrorIs(t, got, tt.expected)
+				_, err := os.Stat(file)
+				assert.Assert(t, os.IsNotExist(err), "the log file was created")
+				return
+			}
+
+			b, err := os.ReadFile(file)
+			assert.NilError(t, err)
+			assert.Assert(t, strings.Contains(string(b), tt.logged), "%q is missing from the log:\n%s", tt.logged, b)
+		})
+	}
+}
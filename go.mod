@@ -3,14 +3,15 @@ module github.com/primlock/zoomies
 go 1.23.3
 
 require (
+	atomicgo.dev/keyboard v0.2.9
 	github.com/prometheus-community/pro-bing v0.5.0
 	github.com/pterm/pterm v0.12.80
 	golang.org/x/net v0.33.0
+	golang.org/x/term v0.27.0
 )
 
 require (
 	atomicgo.dev/cursor v0.2.0 // indirect
-	atomicgo.dev/keyboard v0.2.9 // indirect
 	atomicgo.dev/schedule v0.1.0 // indirect
 	github.com/containerd/console v1.0.3 // indirect
 	github.com/google/uuid v1.6.0 // indirect
@@ -21,7 +22,6 @@ require (
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
 	golang.org/x/sync v0.10.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
-	golang.org/x/term v0.27.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 )
 
@@ -33,5 +33,5 @@ require (
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/cobra v1.8.1
-	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/spf13/pflag v1.0.5
 )
@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	appName       = "zoomies"
+	cacheFileName = "cache.json"
+)
+
+// entries is the content of the cache file. The server list is kept as the raw response so the
+// cache does not depend on how it is decoded.
+type entries struct {
+	Token             string          `json:"token,omitempty"`
+	TokenExpires      time.Time       `json:"token_expires,omitempty"`
+	ServerList        json.RawMessage `json:"server_list,omitempty"`
+	ServerListExpires time.Time       `json:"server_list_expires,omitempty"`
+}
+
+// Cache keeps the fast.com api token and server list between runs. Reads are best effort: a
+// missing, unreadable or corrupt file is treated as empty so the cache never fails a run. A cache
+// without a path keeps nothing.
+type Cache struct {
+	Path string
+
+	now func() time.Time
+}
+
+// DefaultPath returns the location of the cache file under the XDG cache directory, falling back
+// to ~/.cache when XDG_CACHE_HOME is not set.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+
+		dir = filepath.Join(home, ".cache")
+	}
+
+	return filepath.Join(dir, appName, cacheFileName)
+}
+
+func New(path string) *Cache {
+	return &Cache{Path: path, now: time.Now}
+}
+
+// Token returns the cached token when it has not expired.
+func (c *Cache) Token() (string, bool) {
+	e := c.read()
+	if e.Token == "" || !c.now().Before(e.TokenExpires) {
+		return "", false
+	}
+
+	return e.Token, true
+}
+
+// SetToken caches the token for the ttl. The cached server list is dropped because it was fetched
+// with the previous token.
+func (c *Cache) SetToken(token string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return c.write(entries{Token: token, TokenExpires: c.now().Add(ttl)})
+}
+
+// ServerList returns the cached server list response when it has not expired.
+func (c *Cache) ServerList() ([]byte, bool) {
+	e := c.read()
+	if len(e.ServerList) == 0 || !c.now().Before(e.ServerListExpires) {
+		return nil, false
+	}
+
+	return e.ServerList, true
+}
+
+// SetServerList caches the server list response for the ttl alongside the token.
+func (c *Cache) SetServerList(body []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	if !json.Valid(body) {
+		return fmt.Errorf("failed to cache the server list: invalid json")
+	}
+
+	e := c.read()
+	e.ServerList = body
+	e.ServerListExpires = c.now().Add(ttl)
+
+	return c.write(e)
+}
+
+// DropServerList removes the cached server list, keeping the token.
+func (c *Cache) DropServerList() error {
+	e := c.read()
+	if len(e.ServerList) == 0 {
+		return nil
+	}
+
+	e.ServerList = nil
+	e.ServerListExpires = time.Time{}
+
+	return c.write(e)
+}
+
+// Invalidate removes every cached entry.
+func (c *Cache) Invalidate() error {
+	if c.Path == "" {
+		return nil
+	}
+
+	err := os.Remove(c.Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing cache file: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Cache) read() entries {
+	var e entries
+	if c.Path == "" {
+		return e
+	}
+
+	b, err := os.ReadFile(c.Path)
+	if err != nil {
+		return e
+	}
+
+	if err := json.Unmarshal(b, &e); err != nil {
+		return entries{}
+	}
+
+	return e
+}
+
+// write replaces the cache file, writing to a temporary file first so that concurrent runs never
+// read a partial file. The file is only readable by the user since it holds the token.
+func (c *Cache) write(e entries) error {
+	if c.Path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+		return fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.Path), filepath.Base(c.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing cache file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.Path)
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCacheExpiry(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := New(filepath.Join(t.TempDir(), "zoomies", "cache.json"))
+	c.now = func() time.Time { return now }
+
+	_, ok := c.Token()
+	assert.Assert(t, !ok)
+
+	assert.NilError(t, c.SetToken("abc", time.Hour))
+	assert.NilError(t, c.SetServerList([]byte(`{"targets":[]}`), time.Minute))
+
+	token, ok := c.Token()
+	assert.Assert(t, ok)
+	assert.Equal(t, token, "abc")
+
+	list, ok := c.ServerList()
+	assert.Assert(t, ok)
+	assert.Equal(t, string(list), `{"targets":[]}`)
+
+	now = now.Add(2 * time.Minute)
+
+	_, ok = c.ServerList()
+	assert.Assert(t, !ok)
+
+	_, ok = c.Token()
+	assert.Assert(t, ok)
+
+	now = now.Add(time.Hour)
+
+	_, ok = c.Token()
+	assert.Assert(t, !ok)
+}
+
+func TestCacheSetTokenDropsServerList(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "cache.json"))
+
+	assert.NilError(t, c.SetToken("abc", time.Hour))
+	assert.NilError(t, c.SetServerList([]byte(`{}`), time.Hour))
+	assert.NilError(t, c.SetToken("def", time.Hour))
+
+	_, ok := c.ServerList()
+	assert.Assert(t, !ok)
+}
+
+func TestCacheDisabled(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "cache.json"))
+
+	assert.NilError(t, c.SetToken("abc", 0))
+	assert.NilError(t, c.SetServerList([]byte(`{}`), 0))
+
+	_, err := os.Stat(c.Path)
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+func TestCacheWithoutPath(t *testing.T) {
+	c := New("")
+
+	assert.NilError(t, c.SetToken("abc", time.Hour))
+	assert.NilError(t, c.Invalidate())
+
+	_, ok := c.Token()
+	assert.Assert(t, !ok)
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "cache.json"))
+
+	assert.NilError(t, c.Invalidate())
+	assert.NilError(t, c.SetToken("abc", time.Hour))
+	assert.NilError(t, c.Invalidate())
+
+	_, ok := c.Token()
+	assert.Assert(t, !ok)
+}
+
+func TestCacheCorruptFile(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "cache.json"))
+	assert.NilError(t, os.WriteFile(c.Path, []byte("{not json"), 0o600))
+
+	_, ok := c.Token()
+	assert.Assert(t, !ok)
+
+	assert.NilError(t, c.SetToken("abc", time.Hour))
+
+	token, ok := c.Token()
+	assert.Assert(t, ok)
+	assert.Equal(t, token, "abc")
+}
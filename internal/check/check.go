@@ -0,0 +1,106 @@
+package check
+
+import (
+	"time"
+
+	"github.com/primlock/zoomies/api"
+)
+
+const (
+	Download = "download"
+	Upload   = "upload"
+	Latency  = "latency"
+	Loss     = "loss"
+)
+
+// Thresholds are the limits a result must stay within. A zero value disables the check.
+type Thresholds struct {
+	// The lowest acceptable download and upload rates in bits per second.
+	MinDownload float64
+	MinUpload   float64
+
+	// The highest acceptable average round-trip time.
+	MaxLatency time.Duration
+
+	// The highest acceptable packet loss as a percentage. It is a pointer so that a limit of zero
+	// loss can be told apart from no limit.
+	MaxLoss *float64
+}
+
+// Check is the outcome of comparing one measurement against its threshold.
+type Check struct {
+	Name string
+
+	// The threshold and the measurement, in bits per second for transfers, milliseconds for latency
+	// and percent for loss.
+	Limit float64
+	Value float64
+
+	// Whether the measurement was taken. A check on a test that did not run fails.
+	Measured bool
+	Passed   bool
+}
+
+// Evaluate returns a check for each threshold that is set, in the order download, upload, latency
+// and loss.
+func (t *Thresholds) Evaluate(result *api.Result) []Check {
+	var checks []Check
+
+	if t.MinDownload > 0 {
+		c := Check{Name: Download, Limit: t.MinDownload}
+		if result.Download != nil {
+			c.Measured, c.Value = true, result.Download.BitsPerSecond()
+			c.Passed = c.Value >= c.Limit
+		}
+
+		checks = append(checks, c)
+	}
+
+	if t.MinUpload > 0 {
+		c := Check{Name: Upload, Limit: t.MinUpload}
+		if result.Upload != nil {
+			c.Measured, c.Value = true, result.Upload.BitsPerSecond()
+			c.Passed = c.Value >= c.Limit
+		}
+
+		checks = append(checks, c)
+	}
+
+	if t.MaxLatency > 0 {
+		c := Check{Name: Latency, Limit: milliseconds(t.MaxLatency)}
+		if result.Latency != nil {
+			c.Measured, c.Value = true, milliseconds(result.Latency.Ping)
+			c.Passed = c.Value <= c.Limit
+		}
+
+		checks = append(checks, c)
+	}
+
+	if t.MaxLoss != nil {
+		c := Check{Name: Loss, Limit: *t.MaxLoss}
+		if result.Latency != nil {
+			c.Measured, c.Value = true, result.Latency.PacketLoss
+			c.Passed = c.Value <= c.Limit
+		}
+
+		checks = append(checks, c)
+	}
+
+	return checks
+}
+
+// Failed returns the checks that did not pass.
+func Failed(checks []Check) []Check {
+	var failed []Check
+	for _, c := range checks {
+		if !c.Passed {
+			failed = append(failed, c)
+		}
+	}
+
+	return failed
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
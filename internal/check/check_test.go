@@ -0,0 +1,66 @@
+package check
+
+import (
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"gotest.tools/v3/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	result := &api.Result{
+		Download: &api.TransferResult{Bytes: 125000000, Duration: 10 * time.Second},
+		Latency:  &api.LatencyResult{Ping: 25 * time.Millisecond, PacketLoss: 0},
+	}
+
+	zero := 0.0
+
+	testCases := []struct {
+		name       string
+		thresholds Thresholds
+		passed     map[string]bool
+	}{
+		{
+			name:       "No thresholds",
+			thresholds: Thresholds{},
+			passed:     map[string]bool{},
+		},
+		{
+			name:       "All within the limits",
+			thresholds: Thresholds{MinDownload: 50e6, MaxLatency: 30 * time.Millisecond, MaxLoss: &zero},
+			passed:     map[string]bool{Download: true, Latency: true, Loss: true},
+		},
+		{
+			name:       "Download below and latency above",
+			thresholds: Thresholds{MinDownload: 200e6, MaxLatency: 20 * time.Millisecond},
+			passed:     map[string]bool{Download: false, Latency: false},
+		},
+		{
+			name:       "Upload was not measured",
+			thresholds: Thresholds{MinUpload: 1},
+			passed:     map[string]bool{Upload: false},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			checks := tt.thresholds.Evaluate(result)
+
+			got := make(map[string]bool, len(checks))
+			for _, c := range checks {
+				got[c.Name] = c.Passed
+			}
+
+			assert.DeepEqual(t, got, tt.passed)
+		})
+	}
+}
+
+func TestFailed(t *testing.T) {
+	checks := []Check{{Name: Download, Passed: true}, {Name: Upload}, {Name: Loss}}
+
+	failed := Failed(checks)
+	assert.Equal(t, len(failed), 2)
+	assert.Equal(t, failed[0].Name, Upload)
+}
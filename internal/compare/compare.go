@@ -0,0 +1,85 @@
+package compare
+
+import (
+	"time"
+
+	"github.com/primlock/zoomies/api"
+)
+
+const DefaultTolerance = 10.0
+
+// Delta is the change of one metric between a baseline and a current result.
+type Delta struct {
+	Metric string `json:"metric"`
+
+	// The measurements in bits per second for transfers, milliseconds for latency and jitter, and
+	// percent for packet loss.
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+
+	// The percentage change from the baseline to the current measurement. It is zero when the
+	// baseline is zero, since no percentage can be taken of it.
+	Change float64 `json:"change"`
+
+	// Whether a larger value is an improvement, as for throughput, or a regression, as for latency.
+	HigherIsBetter bool `json:"higher_is_better"`
+
+	// Whether the change is worse than the tolerance allows.
+	Regression bool `json:"regression"`
+}
+
+// Compare returns the change of each metric measured in both results. A metric regresses when it
+// gets worse by more than tolerance percent, or at all when its baseline is zero.
+func Compare(baseline, current *api.Result, tolerance float64) []Delta {
+	var deltas []Delta
+
+	add := func(metric string, a, b float64, higherIsBetter bool) {
+		d := Delta{Metric: metric, Baseline: a, Current: b, HigherIsBetter: higherIsBetter}
+
+		switch {
+		case a == 0 && higherIsBetter:
+			d.Regression = b < a
+		case a == 0:
+			d.Regression = b > a
+		case higherIsBetter:
+			d.Change = (b - a) / a * 100
+			d.Regression = d.Change < -tolerance
+		default:
+			d.Change = (b - a) / a * 100
+			d.Regression = d.Change > tolerance
+		}
+
+		deltas = append(deltas, d)
+	}
+
+	if baseline.Download != nil && current.Download != nil {
+		add("download", baseline.Download.BitsPerSecond(), current.Download.BitsPerSecond(), true)
+	}
+
+	if baseline.Upload != nil && current.Upload != nil {
+		add("upload", baseline.Upload.BitsPerSecond(), current.Upload.BitsPerSecond(), true)
+	}
+
+	if baseline.Latency != nil && current.Latency != nil {
+		add("latency", milliseconds(baseline.Latency.Ping), milliseconds(current.Latency.Ping), false)
+		add("jitter", milliseconds(baseline.Latency.Jitter), milliseconds(current.Latency.Jitter), false)
+		add("loss", baseline.Latency.PacketLoss, current.Latency.PacketLoss, false)
+	}
+
+	return deltas
+}
+
+// Regressed reports whether any of the deltas is a regression.
+func Regressed(deltas []Delta) bool {
+	for _, d := range deltas {
+		if d.Regression {
+			return true
+		}
+	}
+
+	return false
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,94 @@
+package compare
+
+import (
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"gotest.tools/v3/assert"
+)
+
+func newResult(downMbps, upMbps uint64, ping, jitter time.Duration, loss float64) *api.Result {
+	return &api.Result{
+		Download: &api.TransferResult{Bytes: downMbps * 125000, Duration: time.Second},
+		Upload:   &api.TransferResult{Bytes: upMbps * 125000, Duration: time.Second},
+		Latency:  &api.LatencyResult{Ping: ping, Jitter: jitter, PacketLoss: loss},
+	}
+}
+
+func TestCompare(t *testing.T) {
+	testCases := []struct {
+		name        string
+		baseline    *api.Result
+		current     *api.Result
+		tolerance   float64
+		changes     map[string]float64
+		regressions []string
+	}{
+		{
+			name:      "Within tolerance",
+			baseline:  newResult(100, 20, 20*time.Millisecond, 2*time.Millisecond, 1),
+			current:   newResult(95, 21, 21*time.Millisecond, 2*time.Millisecond, 1),
+			tolerance: 10,
+			changes:   map[string]float64{"download": -5, "upload": 5, "latency": 5, "jitter": 0, "loss": 0},
+		},
+		{
+			name:        "Throughput drop and latency rise",
+			baseline:    newResult(100, 20, 20*time.Millisecond, 2*time.Millisecond, 1),
+			current:     newResult(80, 20, 30*time.Millisecond, 2*time.Millisecond, 1),
+			tolerance:   10,
+			changes:     map[string]float64{"download": -20, "upload": 0, "latency": 50, "jitter": 0, "loss": 0},
+			regressions: []string{"download", "latency"},
+		},
+		{
+			name:        "Jitter and loss rise",
+			baseline:    newResult(100, 20, 20*time.Millisecond, 2*time.Millisecond, 1),
+			current:     newResult(100, 20, 20*time.Millisecond, 3*time.Millisecond, 2),
+			tolerance:   10,
+			changes:     map[string]float64{"download": 0, "upload": 0, "latency": 0, "jitter": 50, "loss": 100},
+			regressions: []string{"jitter", "loss"},
+		},
+		{
+			name:        "Loss from a zero baseline",
+			baseline:    newResult(100, 20, 20*time.Millisecond, 0, 0),
+			current:     newResult(100, 20, 20*time.Millisecond, 0, 5),
+			tolerance:   10,
+			changes:     map[string]float64{"download": 0, "upload": 0, "latency": 0, "jitter": 0, "loss": 0},
+			regressions: []string{"loss"},
+		},
+		{
+			name:      "Improvements never regress",
+			baseline:  newResult(100, 20, 20*time.Millisecond, 4*time.Millisecond, 2),
+			current:   newResult(200, 40, 10*time.Millisecond, 2*time.Millisecond, 1),
+			tolerance: 0,
+			changes:   map[string]float64{"download": 100, "upload": 100, "latency": -50, "jitter": -50, "loss": -50},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			deltas := Compare(tt.baseline, tt.current, tt.tolerance)
+			assert.Equal(t, len(deltas), 5)
+
+			var regressions []string
+			for _, d := range deltas {
+				assert.Equal(t, d.Change, tt.changes[d.Metric], d.Metric)
+				if d.Regression {
+					regressions = append(regressions, d.Metric)
+				}
+			}
+
+			assert.DeepEqual(t, regressions, tt.regressions)
+			assert.Equal(t, Regressed(deltas), len(tt.regressions) > 0)
+		})
+	}
+}
+
+func TestCompareSkippedTests(t *testing.T) {
+	baseline := newResult(100, 20, 20*time.Millisecond, 2*time.Millisecond, 1)
+	current := newResult(100, 20, 20*time.Millisecond, 2*time.Millisecond, 1)
+	current.Upload = nil
+
+	deltas := Compare(baseline, current, DefaultTolerance)
+	assert.Equal(t, len(deltas), 4)
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+var (
+	ErrUnknownSetting = errors.New("unknown setting")
+	ErrSyntax         = errors.New("syntax error")
+)
+
+const (
+	appName        = "zoomies"
+	configFileName = "config.toml"
+	EnvPrefix      = "ZOOMIES_"
+
+	// Annotation marks the flags that can be set by the config file and environment.
+	Annotation = "zoomies_setting"
+)
+
+// File holds the settings read from a config file. The top-level settings apply to every run and
+// the settings of a profile apply on top of them when the profile is selected. Settings are keyed
+// by the name of the flag they set.
+type File struct {
+	Values   map[string]string
+	Profiles map[string]map[string]string
+}
+
+// Layer is a set of settings along with where they came from, used to name the source in errors.
+type Layer struct {
+	Source string
+	Values map[string]string
+}
+
+// DefaultPath returns the location of the config file under the XDG config directory, falling back
+// to ~/.config when XDG_CONFIG_HOME is not set.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, appName, configFileName)
+}
+
+// Load reads and parses the config file at path.
+func Load(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return file, nil
+}
+
+// Environ returns the settings given by the environment variables starting with the prefix. The
+// rest of the variable name is lowercased and its underscores replaced by dashes, so that
+// ZOOMIES_MIN_DOWNLOAD sets min-download.
+func Environ(prefix string, environ []string) map[string]string {
+	values := map[string]string{}
+
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, prefix) || len(name) == len(prefix) {
+			continue
+		}
+
+		values[normalizeKey(name[len(prefix):])] = value
+	}
+
+	return values
+}
+
+// Mark allows the named flags of the set, or every flag when no names are given, to be set by the
+// config file and environment.
+func Mark(fs *pflag.FlagSet, names ...string) {
+	mark := func(f *pflag.Flag) {
+		if f.Annotations == nil {
+			f.Annotations = map[string][]string{}
+		}
+
+		f.Annotations[Annotation] = []string{"true"}
+	}
+
+	if len(names) == 0 {
+		fs.VisitAll(mark)
+		return
+	}
+
+	for _, name := range names {
+		if f := fs.Lookup(name); f != nil {
+			mark(f)
+		}
+	}
+}
+
+// IsMarked reports whether the flag can be set by the config file and environment.
+func IsMarked(f *pflag.Flag) bool {
+	_, ok := f.Annotations[Annotation]
+	return ok
+}
+
+// Apply sets each marked flag that was not given on the command line to its value in the layers,
+// with later layers taking precedence over earlier ones. Settings without a marked flag in the set
+// are skipped so that one file can hold the settings of every command. The flags are set through
+// their values rather than the set so that they are not reported as changed.
+func Apply(fs *pflag.FlagSet, layers ...Layer) error {
+	values := map[string]string{}
+	sources := map[string]string{}
+
+	for _, l := range layers {
+		for k, v := range l.Values {
+			values[k] = v
+			sources[k] = l.Source
+		}
+	}
+
+	for k, v := range values {
+		f := fs.Lookup(k)
+		if f == nil || f.Changed || !IsMarked(f) {
+			continue
+		}
+
+		if err := f.Value.Set(v); err != nil {
+			return fmt.Errorf("%s: invalid value %q for %s: %w", sources[k], v, k, err)
+		}
+	}
+
+	return nil
+}
+
+// Check returns an error for the first setting in the layers that is not in known.
+func Check(known map[string]bool, layers ...Layer) error {
+	for _, l := range layers {
+		for k := range l.Values {
+			if !known[k] {
+				return fmt.Errorf("%s: %w %q", l.Source, ErrUnknownSetting, k)
+			}
+		}
+	}
+
+	return nil
+}
+
+func normalizeKey(k string) string {
+	return strings.ReplaceAll(strings.ToLower(k), "_", "-")
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"gotest.tools/v3/assert"
+)
+
+func TestParse(t *testing.T) {
+	input := `
+# zoomies settings
+duration = 10
+min_download = "100Mbps" # trailing comment
+binary = true
+statsd-prefix = 'net#edge'
+pushgateway-label = { site = "lon", instance = "edge1" }
+country = ["US", 'CA', ]
+pings = [1, 2]
+
+[profile.night]
+pings = 5
+max-loss = "0.5%"
+`
+
+	got, err := Parse(strings.NewReader(input))
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, got.Values, map[string]string{
+		"duration":          "10",
+		"min-download":      "100Mbps",
+		"binary":            "true",
+		"statsd-prefix":     "net#edge",
+		"pushgateway-label": "instance=edge1,site=lon",
+		"country":           "US,CA",
+		"pings":             "1,2",
+	})
+	assert.DeepEqual(t, got.Profiles, map[string]map[string]string{
+		"night": {"pings": "5", "max-loss": "0.5%"},
+	})
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{name: "Missing value", input: "duration ="},
+		{name: "Missing equals sign", input: "duration 10"},
+		{name: "Unterminated string", input: `token = "abc`},
+		{name: "Table that is not a profile", input: "[servers]"},
+		{name: "Unterminated inline table", input: `labels = { site = "lon"`},
+		{name: "Unterminated array", input: `country = ["US", "CA"`},
+		{name: "Nested array", input: `country = [["US"], ["CA"]]`},
+		{name: "Array value with a comma", input: `city = ["London, UK"]`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.input))
+
+			assert.ErrorIs(t, err, ErrSyntax)
+		})
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	got := Environ(EnvPrefix, []string{"ZOOMIES_MIN_DOWNLOAD=50Mbps", "ZOOMIES_DURATION=5", "ZOOMIES_=x", "HOME=/root"})
+
+	assert.DeepEqual(t, got, map[string]string{"min-download": "50Mbps", "duration": "5"})
+}
+
+func TestApply(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	duration := fs.Int("duration", 15, "")
+	pings := fs.Int("pings", 3, "")
+	token := fs.String("token", "", "")
+	unmarked := fs.String("output", "", "")
+	Mark(fs, "duration", "pings", "token")
+
+	assert.NilError(t, fs.Parse([]string{"--pings=2"}))
+
+	err := Apply(fs,
+		Layer{Source: "file", Values: map[string]string{"duration": "10", "pings": "4", "token": "a", "output": "x"}},
+		Layer{Source: "env", Values: map[string]string{"duration": "20", "unknown": "1"}},
+	)
+	assert.NilError(t, err)
+
+	assert.Equal(t, *duration, 20)
+	assert.Equal(t, *pings, 2)
+	assert.Equal(t, *token, "a")
+	assert.Equal(t, *unmarked, "")
+	assert.Assert(t, !fs.Changed("duration"))
+
+	err = Apply(fs, Layer{Source: "file", Values: map[string]string{"duration": "long"}})
+	assert.ErrorContains(t, err, "file: invalid value \"long\" for duration")
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// profileTable is the table name prefix that holds the settings of a named profile.
+const profileTable = "profile."
+
+var (
+	bareKey   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	tomlValue = regexp.MustCompile(`^[+-]?[0-9A-Za-z_.:+-]+$`)
+)
+
+// Parse reads a config file written in the subset of TOML zoomies uses: comments, key = value
+// pairs whose values are strings, numbers, booleans, arrays of strings and numbers on one line or
+// inline tables of strings, and [profile.name] tables. Arrays are flattened into the comma-separated
+// form taken by the list flags and inline tables into the k=v,k=v form taken by the map flags.
+func Parse(r io.Reader) (*File, error) {
+	file := &File{Values: map[string]string{}, Profiles: map[string]map[string]string{}}
+	table := file.Values
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			name, ok := strings.CutSuffix(strings.TrimPrefix(line, "["), "]")
+			name = strings.TrimSpace(name)
+
+			profile, isProfile := strings.CutPrefix(name, profileTable)
+			if !ok || !isProfile || !bareKey.MatchString(profile) {
+				return nil, fmt.Errorf("line %d: %w: tables must be [profile.<name>]", n, ErrSyntax)
+			}
+
+			if _, ok := file.Profiles[profile]; !ok {
+				file.Profiles[profile] = map[string]string{}
+			}
+
+			table = file.Profiles[profile]
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !bareKey.MatchString(key) {
+			return nil, fmt.Errorf("line %d: %w: expected key = value", n, ErrSyntax)
+		}
+
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w: %s", n, ErrSyntax, err)
+		}
+
+		table[normalizeKey(key)] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// parseValue converts a TOML value into the string form accepted by the flags.
+func parseValue(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", fmt.Errorf("missing value")
+	case raw[0] == '"':
+		return strconv.Unquote(raw)
+	case raw[0] == '\'':
+		s, ok := strings.CutSuffix(raw[1:], "'")
+		if !ok || strings.Contains(s, "'") {
+			return "", fmt.Errorf("unterminated string %s", raw)
+		}
+
+		return s, nil
+	case raw[0] == '[':
+		return parseArray(raw)
+	case raw[0] == '{':
+		return parseInlineTable(raw)
+	case tomlValue.MatchString(raw):
+		return strings.ReplaceAll(raw, "_", ""), nil
+	}
+
+	return "", fmt.Errorf("invalid value %s", raw)
+}
+
+// parseArray flattens an array of strings or numbers, e.g. ["US", "CA"], into its values separated
+// by commas.
+func parseArray(raw string) (string, error) {
+	body, ok := strings.CutSuffix(raw[1:], "]")
+	if !ok {
+		return "", fmt.Errorf("unterminated array %s", raw)
+	}
+
+	var values []string
+	for _, element := range splitArray(body) {
+		element = strings.TrimSpace(element)
+		if element == "" {
+			continue
+		}
+
+		if element[0] == '[' || element[0] == '{' {
+			return "", fmt.Errorf("arrays may only hold strings and numbers: %s", raw)
+		}
+
+		value, err := parseValue(element)
+		if err != nil {
+			return "", err
+		}
+
+		if strings.Contains(value, ",") {
+			return "", fmt.Errorf("array values may not contain commas: %q", value)
+		}
+
+		values = append(values, value)
+	}
+
+	return strings.Join(values, ","), nil
+}
+
+// splitArray splits the body of an array at the commas between its elements, ignoring any comma
+// inside a string.
+func splitArray(body string) []string {
+	var elements []string
+	var quote rune
+	escaped := false
+	start := 0
+
+	for i, c := range body {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			elements = append(elements, body[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(elements, body[start:])
+}
+
+// parseInlineTable flattens an inline table of strings, e.g. { site = "lon", rack = "b2" }, into
+// sorted k=v pairs separated by commas.
+func parseInlineTable(raw string) (string, error) {
+	body, ok := strings.CutSuffix(raw[1:], "}")
+	if !ok {
+		return "", fmt.Errorf("unterminated inline table %s", raw)
+	}
+
+	var pairs []string
+	for _, field := range strings.Split(body, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(field, "=")
+		k = strings.TrimSpace(k)
+		if !ok || !bareKey.MatchString(k) {
+			return "", fmt.Errorf("invalid inline table entry %q", field)
+		}
+
+		value, err := parseValue(strings.TrimSpace(v))
+		if err != nil {
+			return "", err
+		}
+
+		pairs = append(pairs, k+"="+value)
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ","), nil
+}
+
+// stripComment removes a # comment from the line, ignoring any # inside a string.
+func stripComment(line string) string {
+	var quote rune
+	escaped := false
+
+	for i, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,77 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{
+	"id", "timestamp", "client_ip", "isp", "client_city", "client_country",
+	"server", "server_city", "server_country",
+	"ping_ms", "download_bps", "download_bytes", "upload_bps", "upload_bytes",
+	"jitter_ms", "loss_percent",
+}
+
+// WriteCSV writes the records as CSV with a header row. Tests that were skipped are left empty.
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		row := []string{
+			r.ID,
+			r.Timestamp.Format(time.RFC3339),
+			r.Client.IP,
+			r.Client.ISP,
+			r.Client.Location.City,
+			r.Client.Location.Country,
+			r.Server.Name,
+			r.Server.Location.City,
+			r.Server.Location.Country,
+			"", "", "", "", "", "", "",
+		}
+
+		if r.Latency != nil {
+			row[9] = formatFloat(float64(r.Latency.Ping) / float64(time.Millisecond))
+			row[14] = formatFloat(float64(r.Latency.Jitter) / float64(time.Millisecond))
+			row[15] = formatFloat(r.Latency.PacketLoss)
+		}
+
+		if r.Download != nil {
+			row[10] = formatFloat(r.Download.BitsPerSecond())
+			row[11] = strconv.FormatUint(r.Download.Bytes, 10)
+		}
+
+		if r.Upload != nil {
+			row[12] = formatFloat(r.Upload.BitsPerSecond())
+			row[13] = strconv.FormatUint(r.Upload.Bytes, 10)
+		}
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the records as an indented JSON array.
+func WriteJSON(w io.Writer, records []Record) error {
+	if records == nil {
+		records = []Record{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
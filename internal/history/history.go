@@ -0,0 +1,116 @@
+package history
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+)
+
+var ErrRecordNotFound = errors.New("no history record found with that id")
+
+const (
+	appName         = "zoomies"
+	historyFileName = "history.jsonl"
+)
+
+// Record is a result kept in the history store along with the id used to refer to it.
+type Record struct {
+	ID string `json:"id"`
+	api.Result
+}
+
+// Filter selects the records returned from the store. Zero values match every record.
+type Filter struct {
+	// Only records taken at or after this time.
+	Since time.Time
+
+	// Only records taken before this time.
+	Until time.Time
+
+	// Only records whose server name, city or country contain this string.
+	Server string
+
+	// Only records whose client ISP contains this string.
+	ISP string
+
+	// Only the most recent records up to this count.
+	Limit int
+}
+
+// Store keeps the results of every run. It satisfies sink.Sink so it can be written to alongside
+// the other result sinks.
+type Store interface {
+	// Write adds the result to the store.
+	Write(ctx context.Context, result *api.Result) error
+
+	// List returns the records matching the filter, oldest first.
+	List(filter Filter) ([]Record, error)
+
+	// Get returns the record with the id.
+	Get(id string) (*Record, error)
+
+	// Prune removes the records matching the filter and returns how many were removed.
+	Prune(filter Filter) (int, error)
+}
+
+// DefaultPath returns the location of the history file under the XDG data directory, falling
+// back to ~/.local/share when XDG_DATA_HOME is not set.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+
+		dir = filepath.Join(home, ".local", "share")
+	}
+
+	return filepath.Join(dir, appName, historyFileName)
+}
+
+// Open returns the store backing the file at path. Only the JSONL backend exists today.
+func Open(path string) (Store, error) {
+	return NewJSONL(path), nil
+}
+
+// Matches reports whether the record is selected by the filter, ignoring the limit.
+func (f Filter) Matches(r *Record) bool {
+	if !f.Since.IsZero() && r.Timestamp.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && !r.Timestamp.Before(f.Until) {
+		return false
+	}
+
+	if f.Server != "" {
+		s := r.Server
+		if !containsFold(s.Name, f.Server) && !containsFold(s.Location.City, f.Server) && !containsFold(s.Location.Country, f.Server) {
+			return false
+		}
+	}
+
+	if f.ISP != "" && !containsFold(r.Client.ISP, f.ISP) {
+		return false
+	}
+
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func newID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
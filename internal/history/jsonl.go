@@ -0,0 +1,210 @@
+package history
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/primlock/zoomies/api"
+)
+
+// JSONL stores each record as a line of JSON in a single append-only file. Appends and prunes take
+// an exclusive lock so that a prune does not drop a record appended by another process.
+type JSONL struct {
+	Path string
+}
+
+func NewJSONL(path string) *JSONL {
+	return &JSONL{Path: path}
+}
+
+func (j *JSONL) Write(ctx context.Context, result *api.Result) error {
+	line, err := json.Marshal(Record{ID: newID(), Result: *result})
+	if err != nil {
+		return fmt.Errorf("failed to encode history record: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.Path), 0o755); err != nil {
+		return fmt.Errorf("error creating history directory: %w", err)
+	}
+
+	unlock, err := j.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(j.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening history file: %w", err)
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing history file: %w", err)
+	}
+
+	return f.Close()
+}
+
+func (j *JSONL) List(filter Filter) ([]Record, error) {
+	all, err := j.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for i := range all {
+		if filter.Matches(&all[i]) {
+			records = append(records, all[i])
+		}
+	}
+
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[len(records)-filter.Limit:]
+	}
+
+	return records, nil
+}
+
+func (j *JSONL) Get(id string) (*Record, error) {
+	all, err := j.read()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range all {
+		if all[i].ID == id {
+			return &all[i], nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (j *JSONL) Prune(filter Filter) (int, error) {
+	if _, err := os.Stat(j.Path); errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+
+	unlock, err := j.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	all, err := j.read()
+	if err != nil {
+		return 0, err
+	}
+
+	kept := make([]Record, 0, len(all))
+	for i := range all {
+		if !filter.Matches(&all[i]) {
+			kept = append(kept, all[i])
+		}
+	}
+
+	removed := len(all) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	return removed, j.rewrite(kept)
+}
+
+// lock takes the exclusive lock on the history and returns the function that releases it. The lock
+// is held on a file next to the history since a prune replaces the history file.
+func (j *JSONL) lock() (func(), error) {
+	f, err := os.OpenFile(j.Path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening history lock file: %w", err)
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error locking history file: %w", err)
+	}
+
+	return func() { f.Close() }, nil
+}
+
+// read loads every record in the file. A missing file is treated as an empty history.
+func (j *JSONL) read() ([]Record, error) {
+	f, err := os.Open(j.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error opening history file: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("error parsing %s line %d: %w", j.Path, n, err)
+		}
+
+		records = append(records, r)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading history file: %w", err)
+	}
+
+	return records, nil
+}
+
+// rewrite replaces the file with the records, writing to a temporary file first so that an
+// interrupted prune leaves the history intact. The file keeps its mode.
+func (j *JSONL) rewrite(records []Record) error {
+	info, err := os.Stat(j.Path)
+	if err != nil {
+		return fmt.Errorf("error opening history file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.Path), filepath.Base(j.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary history file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to encode history record: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing history file: %w", err)
+	}
+
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing history file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), j.Path)
+}
@@ -0,0 +1,163 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"gotest.tools/v3/assert"
+)
+
+func newResult(ts time.Time, city, isp string) *api.Result {
+	r := &api.Result{
+		Timestamp: ts,
+		Latency:   &api.LatencyResult{Ping: 15 * time.Millisecond, Jitter: 2 * time.Millisecond, PacketLoss: 25},
+		Download:  &api.TransferResult{Bytes: 125000000, Duration: 10 * time.Second},
+	}
+	r.Server.Location.City = city
+	r.Client.ISP = isp
+	return r
+}
+
+func newTestStore(t *testing.T) *JSONL {
+	store := NewJSONL(filepath.Join(t.TempDir(), "zoomies", historyFileName))
+	day := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	results := []*api.Result{
+		newResult(day, "London", "Example ISP"),
+		newResult(day.AddDate(0, 0, 1), "Paris", "Example ISP"),
+		newResult(day.AddDate(0, 0, 2), "London", "Other Networks"),
+	}
+
+	for _, r := range results {
+		assert.NilError(t, store.Write(context.Background(), r))
+	}
+
+	return store
+}
+
+func TestJSONLList(t *testing.T) {
+	store := newTestStore(t)
+	day := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{name: "No filter", filter: Filter{}, expected: []string{"London", "Paris", "London"}},
+		{name: "Since", filter: Filter{Since: day.AddDate(0, 0, 1)}, expected: []string{"Paris", "London"}},
+		{name: "Until", filter: Filter{Until: day.AddDate(0, 0, 1)}, expected: []string{"London"}},
+		{name: "Server", filter: Filter{Server: "london"}, expected: []string{"London", "London"}},
+		{name: "ISP", filter: Filter{ISP: "example"}, expected: []string{"London", "Paris"}},
+		{name: "Limit keeps the most recent", filter: Filter{Limit: 1}, expected: []string{"London"}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := store.List(tt.filter)
+			assert.NilError(t, err)
+
+			cities := make([]string, len(records))
+			for i, r := range records {
+				cities[i] = r.Server.Location.City
+			}
+
+			assert.DeepEqual(t, cities, tt.expected)
+		})
+	}
+}
+
+func TestJSONLGet(t *testing.T) {
+	store := newTestStore(t)
+
+	records, err := store.List(Filter{})
+	assert.NilError(t, err)
+
+	got, err := store.Get(records[1].ID)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Server.Location.City, "Paris")
+
+	_, err = store.Get("missing")
+	assert.Error(t, err, ErrRecordNotFound.Error())
+}
+
+func TestJSONLPrune(t *testing.T) {
+	store := newTestStore(t)
+
+	n, err := store.Prune(Filter{Until: time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)})
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	records, err := store.List(Filter{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 2)
+	assert.Equal(t, records[0].Server.Location.City, "Paris")
+}
+
+func TestJSONLPruneKeepsMode(t *testing.T) {
+	store := newTestStore(t)
+	assert.NilError(t, os.Chmod(store.Path, 0o640))
+
+	_, err := store.Prune(Filter{ISP: "other"})
+	assert.NilError(t, err)
+
+	info, err := os.Stat(store.Path)
+	assert.NilError(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0o640))
+}
+
+func TestJSONLPruneWhileAppending(t *testing.T) {
+	store := NewJSONL(filepath.Join(t.TempDir(), historyFileName))
+	day := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	const appends = 50
+	var wg sync.WaitGroup
+	for i := 0; i < appends; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.Check(t, store.Write(context.Background(), newResult(day, "London", "Kept")))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.Check(t, store.Write(context.Background(), newResult(day, "Paris", "Pruned")))
+			_, err := store.Prune(Filter{ISP: "pruned"})
+			assert.Check(t, err)
+		}()
+	}
+	wg.Wait()
+
+	records, err := store.List(Filter{ISP: "kept"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), appends)
+}
+
+func TestJSONLMissingFile(t *testing.T) {
+	store := NewJSONL(filepath.Join(t.TempDir(), "missing.jsonl"))
+
+	records, err := store.List(Filter{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 0)
+}
+
+func TestWriteCSV(t *testing.T) {
+	store := newTestStore(t)
+
+	records, err := store.List(Filter{Limit: 1})
+	assert.NilError(t, err)
+
+	var b bytes.Buffer
+	assert.NilError(t, WriteCSV(&b, records))
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Equal(t, len(lines), 2)
+	assert.Equal(t, lines[0], strings.Join(csvHeader, ","))
+	assert.Equal(t, lines[1], records[0].ID+",2024-01-03T12:00:00Z,,Other Networks,,,,London,,15.00,100000000.00,125000000,,,2.00,25.00")
+}
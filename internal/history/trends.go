@@ -0,0 +1,112 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/primlock/zoomies/internal/stats"
+)
+
+var ErrUnknownGrouping = errors.New("grouping must be one of day, week or hour")
+
+// Grouping determines how records are bucketed when computing trends.
+type Grouping string
+
+const (
+	// Daily buckets records by calendar day.
+	Daily Grouping = "day"
+
+	// Weekly buckets records by ISO week.
+	Weekly Grouping = "week"
+
+	// HourOfDay buckets records by the hour of the day they were taken, across all days, to
+	// reveal patterns such as evening congestion.
+	HourOfDay Grouping = "hour"
+)
+
+// Bucket holds the aggregated measurements of the records that fall within one period.
+type Bucket struct {
+	Label string `json:"label"`
+
+	// Download and upload rates in bits per second.
+	Download stats.Summary `json:"download"`
+	Upload   stats.Summary `json:"upload"`
+
+	// Latency in milliseconds.
+	Latency stats.Summary `json:"latency"`
+}
+
+func ParseGrouping(s string) (Grouping, error) {
+	switch g := Grouping(s); g {
+	case Daily, Weekly, HourOfDay:
+		return g, nil
+	default:
+		return "", ErrUnknownGrouping
+	}
+}
+
+// Trends groups the records and summarizes each group, in chronological order for days and weeks
+// and by hour for the time of day. Times are bucketed in the location given.
+func Trends(records []Record, by Grouping, loc *time.Location) []Bucket {
+	type samples struct {
+		download, upload, latency []float64
+	}
+
+	groups := make(map[string]*samples)
+	for _, r := range records {
+		key := bucketLabel(r.Timestamp.In(loc), by)
+
+		s, ok := groups[key]
+		if !ok {
+			s = &samples{}
+			groups[key] = s
+		}
+
+		if r.Download != nil {
+			s.download = append(s.download, r.Download.BitsPerSecond())
+		}
+
+		if r.Upload != nil {
+			s.upload = append(s.upload, r.Upload.BitsPerSecond())
+		}
+
+		if r.Latency != nil {
+			s.latency = append(s.latency, float64(r.Latency.Ping)/float64(time.Millisecond))
+		}
+	}
+
+	labels := make([]string, 0, len(groups))
+	for k := range groups {
+		labels = append(labels, k)
+	}
+
+	// Every label format sorts lexically in chronological order.
+	sort.Strings(labels)
+
+	buckets := make([]Bucket, len(labels))
+	for i, l := range labels {
+		s := groups[l]
+		buckets[i] = Bucket{
+			Label:    l,
+			Download: stats.Summarize(s.download),
+			Upload:   stats.Summarize(s.upload),
+			Latency:  stats.Summarize(s.latency),
+		}
+	}
+
+	return buckets
+}
+
+func bucketLabel(t time.Time, by Grouping) string {
+	switch by {
+	case Weekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case HourOfDay:
+		return fmt.Sprintf("%02d:00", t.Hour())
+	default:
+		return t.Format(time.DateOnly)
+	}
+}
@@ -0,0 +1,65 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"gotest.tools/v3/assert"
+)
+
+func TestTrends(t *testing.T) {
+	record := func(ts time.Time, mbps uint64, ping time.Duration) Record {
+		return Record{Result: api.Result{
+			Timestamp: ts,
+			Download:  &api.TransferResult{Bytes: mbps * 125000, Duration: time.Second},
+			Latency:   &api.LatencyResult{Ping: ping},
+		}}
+	}
+
+	// Monday 1 January 2024 and the following days.
+	day := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	records := []Record{
+		record(day.Add(9*time.Hour), 100, 10*time.Millisecond),
+		record(day.Add(20*time.Hour), 40, 30*time.Millisecond),
+		record(day.AddDate(0, 0, 1).Add(9*time.Hour), 90, 12*time.Millisecond),
+		record(day.AddDate(0, 0, 1).Add(20*time.Hour), 50, 28*time.Millisecond),
+		record(day.AddDate(0, 0, 7).Add(20*time.Hour), 60, 20*time.Millisecond),
+	}
+
+	testCases := []struct {
+		name    string
+		by      Grouping
+		labels  []string
+		medians []float64
+	}{
+		{name: "Daily", by: Daily, labels: []string{"2024-01-01", "2024-01-02", "2024-01-08"}, medians: []float64{70e6, 70e6, 60e6}},
+		{name: "Weekly", by: Weekly, labels: []string{"2024-W01", "2024-W02"}, medians: []float64{70e6, 60e6}},
+		{name: "Hour of day", by: HourOfDay, labels: []string{"09:00", "20:00"}, medians: []float64{95e6, 50e6}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			buckets := Trends(records, tt.by, time.UTC)
+
+			labels := make([]string, len(buckets))
+			medians := make([]float64, len(buckets))
+			for i, b := range buckets {
+				labels[i] = b.Label
+				medians[i] = b.Download.Median
+			}
+
+			assert.DeepEqual(t, labels, tt.labels)
+			assert.DeepEqual(t, medians, tt.medians)
+		})
+	}
+}
+
+func TestParseGrouping(t *testing.T) {
+	g, err := ParseGrouping("week")
+	assert.NilError(t, err)
+	assert.Equal(t, g, Weekly)
+
+	_, err = ParseGrouping("month")
+	assert.Error(t, err, ErrUnknownGrouping.Error())
+}
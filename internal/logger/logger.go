@@ -1,59 +1,92 @@
+// Package logger builds the structured logger of the command and carries it in contexts, so that
+// each package logs with the fields of the work in progress, such as the phase of a run and the
+// server under test.
 package logger
 
 import (
-	"log"
-	"os"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
 )
 
-type Logger interface {
-	Debug(v ...interface{})
-	Info(v ...interface{})
-	Warn(v ...interface{})
-	Error(v ...interface{})
-}
+var (
+	ErrUnknownLevel  = errors.New("log level must be one of debug, info, warn or error")
+	ErrUnknownFormat = errors.New("log format must be one of text or json")
+)
+
+const (
+	FormatText    = "text"
+	FormatJSON    = "json"
+	DefaultFormat = FormatText
+	DefaultLevel  = "warn"
+)
 
-type Log struct {
-	debug *log.Logger
-	info  *log.Logger
-	warn  *log.Logger
-	err   *log.Logger
-	flag  bool
+// The keys of the fields attached to the records of a run.
+const (
+	KeyRequestID = "request_id"
+	KeyPhase     = "phase"
+	KeyServer    = "server"
+)
+
+// levels are the levels a logger can be created with by name.
+var levels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
 }
 
-var TLog = NewLog()
+// New returns a logger that writes the records at the named level and above to w in the format.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	l, ok := levels[strings.ToLower(level)]
+	if !ok {
+		return nil, ErrUnknownLevel
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
 
-func NewLog() *Log {
-	return &Log{
-		debug: log.New(os.Stdout, "DEBUG:\t", log.LstdFlags),
-		info:  log.New(os.Stdout, "INFO:\t", log.LstdFlags),
-		warn:  log.New(os.Stdout, "WARN:\t", log.LstdFlags),
-		err:   log.New(os.Stdout, "ERROR:\t", log.LstdFlags),
-		flag:  false,
+	switch format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
 	}
+
+	return nil, ErrUnknownFormat
 }
 
-func (l *Log) Debug(format string, a ...any) {
-	if l.flag {
-		l.debug.Printf(format, a...)
-	}
+// Discard returns a logger that drops every record.
+func Discard() *slog.Logger {
+	return slog.New(discardHandler{})
 }
 
-func (l *Log) Info(format string, a ...any) {
-	if l.flag {
-		l.info.Printf(format, a...)
-	}
+type contextKey struct{}
+
+// NewContext returns a copy of the context that carries the logger.
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
 }
 
-func (l *Log) Warn(format string, a ...any) {
-	if l.flag {
-		l.warn.Printf(format, a...)
+// FromContext returns the logger carried by the context, or one that drops every record.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return l
 	}
-}
 
-func (l *Log) Error(format string, a ...any) {
-	l.err.Printf(format, a...)
+	return Discard()
 }
 
-func (l *Log) Verbose() {
-	l.flag = true
+// With returns a copy of the context whose logger adds the key-value pairs to each record.
+func With(ctx context.Context, args ...any) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(args...))
 }
+
+// discardHandler drops every record. It stands in for slog.DiscardHandler of newer Go releases.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
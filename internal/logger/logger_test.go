@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name     string
+		format   string
+		level    string
+		expected string
+		err      error
+	}{
+		{name: "Text at the info level", format: FormatText, level: "info", expected: "level=WARN msg=retrying phase=download\n"},
+		{name: "JSON at the debug level", format: FormatJSON, level: "DEBUG", expected: `{"level":"DEBUG","msg":"probed","phase":"download"}` + "\n" + `{"level":"WARN","msg":"retrying","phase":"download"}` + "\n"},
+		{name: "Records below the level dropped", format: FormatText, level: "error"},
+		{name: "Unknown level", format: FormatText, level: "verbose", err: ErrUnknownLevel},
+		{name: "Level with an offset", format: FormatText, level: "info+2", err: ErrUnknownLevel},
+		{name: "Unknown format", format: "xml", level: "info", err: ErrUnknownFormat},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			l, err := New(&b, tt.format, tt.level)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NilError(t, err)
+
+			// The time is left out so that the output can be compared.
+			ctx := With(NewContext(context.Background(), l), KeyPhase, "download")
+			FromContext(ctx).Debug("probed")
+			FromContext(ctx).Warn("retrying")
+
+			assert.Equal(t, stripTime(b.String()), tt.expected)
+		})
+	}
+}
+
+func TestFromContextWithoutLogger(t *testing.T) {
+	l := FromContext(context.Background())
+
+	assert.Assert(t, !l.Enabled(context.Background(), slog.LevelError))
+}
+
+// stripTime removes the time field the handlers write first in each record.
+func stripTime(s string) string {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter([]byte(s), []byte("\n")) {
+		switch {
+		case bytes.HasPrefix(line, []byte("time=")):
+			line = line[bytes.IndexByte(line, ' ')+1:]
+		case bytes.HasPrefix(line, []byte(`{"time":`)):
+			line = append([]byte("{"), line[bytes.IndexByte(line, ',')+1:]...)
+		}
+
+		out.Write(line)
+	}
+
+	return out.String()
+}
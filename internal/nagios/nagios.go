@@ -0,0 +1,192 @@
+package nagios
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/check"
+)
+
+// Status is the state reported by a check plugin. Its value is the exit code of the plugin.
+type Status int
+
+const (
+	OK Status = iota
+	Warning
+	Critical
+	Unknown
+)
+
+const serviceName = "ZOOMIES"
+
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "OK"
+	case Warning:
+		return "WARNING"
+	case Critical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Report returns the status of the result against the warning and critical thresholds, either of
+// which may be nil, and the single status line with perfdata that the plugin prints.
+func Report(result *api.Result, warning, critical *check.Thresholds) (Status, string) {
+	warn := failures(warning, result)
+	crit := failures(critical, result)
+
+	status := OK
+	if len(warn) > 0 {
+		status = Warning
+	}
+
+	if len(crit) > 0 {
+		status = Critical
+	}
+
+	var parts []string
+	if result.Download != nil {
+		parts = append(parts, annotate("download "+api.BitRate(result.Download.BitsPerSecond(), false), check.Download, crit, warn, false))
+	}
+
+	if result.Upload != nil {
+		parts = append(parts, annotate("upload "+api.BitRate(result.Upload.BitsPerSecond(), false), check.Upload, crit, warn, false))
+	}
+
+	if l := result.Latency; l != nil {
+		parts = append(parts,
+			annotate("ping "+l.Ping.Round(time.Millisecond/10).String(), check.Latency, crit, warn, false),
+			"jitter "+l.Jitter.Round(time.Millisecond/10).String(),
+			annotate(fmt.Sprintf("loss %.1f%%", l.PacketLoss), check.Loss, crit, warn, true),
+		)
+	}
+
+	// Checks on tests that did not run have no measurement to annotate.
+	for _, name := range []string{check.Download, check.Upload, check.Latency, check.Loss} {
+		c, ok := crit[name]
+		if !ok {
+			c, ok = warn[name]
+		}
+
+		if ok && !c.Measured {
+			parts = append(parts, name+" not measured")
+		}
+	}
+
+	return status, fmt.Sprintf("%s %s - %s | %s", serviceName, status, strings.Join(parts, ", "), perfdata(result, warning, critical))
+}
+
+// UnknownLine returns the status line reported when the test could not be run.
+func UnknownLine(err error) string {
+	return fmt.Sprintf("%s %s - %s", serviceName, Unknown, err)
+}
+
+func failures(t *check.Thresholds, result *api.Result) map[string]check.Check {
+	failed := make(map[string]check.Check)
+	if t == nil {
+		return failed
+	}
+
+	for _, c := range check.Failed(t.Evaluate(result)) {
+		failed[c.Name] = c
+	}
+
+	return failed
+}
+
+// annotate appends the threshold that a measurement failed to the text, critical before warning.
+func annotate(text, name string, crit, warn map[string]check.Check, percent bool) string {
+	c, ok := crit[name]
+	if !ok {
+		if c, ok = warn[name]; !ok {
+			return text
+		}
+	}
+
+	op := ">"
+	if name == check.Download || name == check.Upload {
+		op = "<"
+	}
+
+	var limit string
+	switch {
+	case name == check.Latency:
+		limit = fmt.Sprintf("%.1fms", c.Limit)
+	case percent:
+		limit = fmt.Sprintf("%.1f%%", c.Limit)
+	default:
+		limit = api.BitRate(c.Limit, false)
+	}
+
+	return fmt.Sprintf("%s (%s %s)", text, op, limit)
+}
+
+// perfdata renders the measurements in the 'label'=value[UOM];[warn];[crit];[min];[max] format.
+func perfdata(result *api.Result, warning, critical *check.Thresholds) string {
+	var out []string
+
+	if result.Download != nil {
+		out = append(out, perf("download", num(result.Download.BitsPerSecond()), "",
+			minRange(warning, func(t *check.Thresholds) float64 { return t.MinDownload }),
+			minRange(critical, func(t *check.Thresholds) float64 { return t.MinDownload }), "0", ""))
+	}
+
+	if result.Upload != nil {
+		out = append(out, perf("upload", num(result.Upload.BitsPerSecond()), "",
+			minRange(warning, func(t *check.Thresholds) float64 { return t.MinUpload }),
+			minRange(critical, func(t *check.Thresholds) float64 { return t.MinUpload }), "0", ""))
+	}
+
+	if l := result.Latency; l != nil {
+		latency := func(t *check.Thresholds) string {
+			if t == nil || t.MaxLatency <= 0 {
+				return ""
+			}
+
+			return num(ms(t.MaxLatency))
+		}
+
+		loss := func(t *check.Thresholds) string {
+			if t == nil || t.MaxLoss == nil {
+				return ""
+			}
+
+			return num(*t.MaxLoss)
+		}
+
+		out = append(out,
+			perf("ping", num(ms(l.Ping)), "ms", latency(warning), latency(critical), "0", ""),
+			perf("jitter", num(ms(l.Jitter)), "ms", "", "", "0", ""),
+			perf("loss", num(l.PacketLoss), "%", loss(warning), loss(critical), "0", "100"),
+		)
+	}
+
+	return strings.Join(out, " ")
+}
+
+func perf(label, value, uom, warn, crit, min, max string) string {
+	return fmt.Sprintf("%s=%s%s;%s;%s;%s;%s", label, value, uom, warn, crit, min, max)
+}
+
+// minRange returns the threshold as a range that alerts when the value falls below it.
+func minRange(t *check.Thresholds, get func(t *check.Thresholds) float64) string {
+	if t == nil || get(t) <= 0 {
+		return ""
+	}
+
+	return num(get(t)) + ":"
+}
+
+func num(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,75 @@
+package nagios
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/check"
+	"gotest.tools/v3/assert"
+)
+
+func TestReport(t *testing.T) {
+	result := &api.Result{
+		Download: &api.TransferResult{Bytes: 100000000, Duration: 10 * time.Second},
+		Upload:   &api.TransferResult{Bytes: 25000000, Duration: 10 * time.Second},
+		Latency:  &api.LatencyResult{Ping: 12300 * time.Microsecond, Jitter: 2 * time.Millisecond, PacketLoss: 0},
+	}
+
+	zero, five := 0.0, 5.0
+
+	testCases := []struct {
+		name     string
+		warning  *check.Thresholds
+		critical *check.Thresholds
+		status   Status
+		line     string
+	}{
+		{
+			name:   "No thresholds",
+			status: OK,
+			line: "ZOOMIES OK - download 80.00 Mbps, upload 20.00 Mbps, ping 12.3ms, jitter 2ms, loss 0.0% | " +
+				"download=80000000;;;0; upload=20000000;;;0; ping=12.3ms;;;0; jitter=2ms;;;0; loss=0%;;;0;100",
+		},
+		{
+			name:     "Download below the warning threshold",
+			warning:  &check.Thresholds{MinDownload: 100e6, MaxLoss: &zero},
+			critical: &check.Thresholds{MinDownload: 50e6, MaxLatency: 50 * time.Millisecond, MaxLoss: &five},
+			status:   Warning,
+			line: "ZOOMIES WARNING - download 80.00 Mbps (< 100.00 Mbps), upload 20.00 Mbps, ping 12.3ms, jitter 2ms, loss 0.0% | " +
+				"download=80000000;100000000:;50000000:;0; upload=20000000;;;0; ping=12.3ms;;50;0; jitter=2ms;;;0; loss=0%;0;5;0;100",
+		},
+		{
+			name:     "Latency above the critical threshold",
+			warning:  &check.Thresholds{MaxLatency: 5 * time.Millisecond},
+			critical: &check.Thresholds{MaxLatency: 10 * time.Millisecond},
+			status:   Critical,
+			line: "ZOOMIES CRITICAL - download 80.00 Mbps, upload 20.00 Mbps, ping 12.3ms (> 10.0ms), jitter 2ms, loss 0.0% | " +
+				"download=80000000;;;0; upload=20000000;;;0; ping=12.3ms;5;10;0; jitter=2ms;;;0; loss=0%;;;0;100",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			status, line := Report(result, tt.warning, tt.critical)
+
+			assert.Equal(t, status, tt.status)
+			assert.Equal(t, line, tt.line)
+		})
+	}
+}
+
+func TestReportNotMeasured(t *testing.T) {
+	result := &api.Result{Download: &api.TransferResult{Bytes: 100000000, Duration: 10 * time.Second}}
+
+	status, line := Report(result, nil, &check.Thresholds{MinUpload: 10e6})
+
+	assert.Equal(t, status, Critical)
+	assert.Equal(t, line, "ZOOMIES CRITICAL - download 80.00 Mbps, upload not measured | download=80000000;;;0;")
+}
+
+func TestUnknownLine(t *testing.T) {
+	assert.Equal(t, UnknownLine(errors.New("no servers")), "ZOOMIES UNKNOWN - no servers")
+	assert.Equal(t, int(Unknown), 3)
+}
@@ -0,0 +1,97 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy describes how often and how quickly a failed operation is tried again.
+type Policy struct {
+	// The number of times the operation is run at most, including the first attempt.
+	Attempts int
+
+	// The delay before the first retry. Each following delay doubles up to Max.
+	Initial time.Duration
+
+	// The upper bound of the delay between attempts.
+	Max time.Duration
+}
+
+const (
+	DefaultRetries = 3
+	DefaultInitial = 500 * time.Millisecond
+	DefaultMax     = 8 * time.Second
+)
+
+// NewPolicy returns a policy that retries up to the number of retries with the default backoff.
+func NewPolicy(retries int) Policy {
+	return Policy{Attempts: retries + 1, Initial: DefaultInitial, Max: DefaultMax}
+}
+
+// Delay returns the time to wait before the retry with the number, starting at 1. The exponential
+// delay is jittered between half and all of its length so that clients do not retry in lockstep.
+func (p Policy) Delay(retry int) time.Duration {
+	d := p.Initial
+	for i := 1; i < retry && d < p.Max; i++ {
+		d *= 2
+	}
+
+	if d > p.Max {
+		d = p.Max
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + rand.N(d/2+1)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks the error as one that retrying will not fix.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// Do runs fn until it succeeds, returns a permanent error, the context ends or the attempts of the
+// policy are used up, waiting between attempts. The last error of fn is returned with a permanent
+// marking removed.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+
+		if attempt >= p.Attempts || ctx.Err() != nil {
+			return err
+		}
+
+		t := time.NewTimer(p.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDo(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	policy := Policy{Attempts: 3, Initial: time.Millisecond, Max: 2 * time.Millisecond}
+
+	testCases := []struct {
+		name     string
+		failures int
+		fail     func(err error) error
+		calls    int
+		expected error
+	}{
+		{name: "Succeeds on the first attempt", failures: 0, calls: 1},
+		{name: "Succeeds after retrying", failures: 2, calls: 3},
+		{name: "Attempts used up", failures: 5, calls: 3, expected: errFlaky},
+		{name: "Permanent error", failures: 5, fail: Permanent, calls: 1, expected: errFlaky},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Do(context.Background(), policy, func(ctx context.Context) error {
+				calls++
+				if calls > tt.failures {
+					return nil
+				}
+				if tt.fail != nil {
+					return tt.fail(errFlaky)
+				}
+				return errFlaky
+			})
+
+			assert.Equal(t, calls, tt.calls)
+			if tt.expected == nil {
+				assert.NilError(t, err)
+			} else {
+				assert.Equal(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDoStopsWithTheContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{Attempts: 10, Initial: time.Hour, Max: time.Hour}
+
+	calls := 0
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	err := Do(ctx, policy, func(ctx context.Context) error {
+		calls++
+		return errors.New("down")
+	})
+
+	assert.Error(t, err, "down")
+	assert.Equal(t, calls, 1)
+}
+
+func TestDelay(t *testing.T) {
+	p := Policy{Attempts: 10, Initial: 100 * time.Millisecond, Max: time.Second}
+
+	testCases := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{retry: 1, max: 100 * time.Millisecond},
+		{retry: 2, max: 200 * time.Millisecond},
+		{retry: 3, max: 400 * time.Millisecond},
+		{retry: 8, max: time.Second},
+	}
+
+	for _, tt := range testCases {
+		for i := 0; i < 20; i++ {
+			d := p.Delay(tt.retry)
+			assert.Assert(t, d >= tt.max/2 && d <= tt.max, "retry %d delay %s", tt.retry, d)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday.
+	from := time.Date(2024, time.January, 10, 10, 7, 30, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		expr     string
+		expected time.Time
+	}{
+		{name: "Every minute", expr: "* * * * *", expected: time.Date(2024, 1, 10, 10, 8, 0, 0, time.UTC)},
+		{name: "Every 15 minutes", expr: "*/15 * * * *", expected: time.Date(2024, 1, 10, 10, 15, 0, 0, time.UTC)},
+		{name: "Hourly descriptor", expr: "@hourly", expected: time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{name: "List of hours", expr: "30 6,18 * * *", expected: time.Date(2024, 1, 10, 18, 30, 0, 0, time.UTC)},
+		{name: "Weekday range rolls to Monday", expr: "0 9 * * mon-fri", expected: time.Date(2024, 1, 11, 9, 0, 0, 0, time.UTC)},
+		{name: "Sunday as 7", expr: "0 0 * * 7", expected: time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{name: "Month name", expr: "0 0 1 mar *", expected: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "Day of month or day of week", expr: "0 0 1 * 5", expected: time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{name: "Leap day", expr: "0 0 29 2 *", expected: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			assert.NilError(t, err)
+			assert.Equal(t, c.Next(from), tt.expected)
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{name: "Too few fields", expr: "* * * *", expected: ErrCronFieldCount.Error()},
+		{name: "Value out of range", expr: "60 * * * *", expected: `invalid value "60" in minute field (0-59)`},
+		{name: "Bad step", expr: "*/0 * * * *", expected: `invalid step in minute field "*/0"`},
+		{name: "Reversed range", expr: "* 5-1 * * *", expected: `invalid range in hour field "5-1"`},
+		{name: "Never matches", expr: "0 0 31 2 *", expected: ErrCronNoMatch.Error()},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			assert.Error(t, err, tt.expected)
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	assert.Equal(t, Jitter(0), time.Duration(0))
+
+	for i := 0; i < 100; i++ {
+		j := Jitter(time.Second)
+		assert.Assert(t, j >= 0 && j < time.Second)
+	}
+}
@@ -0,0 +1,29 @@
+package schedule
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Schedule determines when the next run should take place.
+type Schedule interface {
+	// Next returns the first activation time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// Interval activates at a fixed period from the previous activation.
+type Interval time.Duration
+
+func (i Interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// Jitter returns a random duration in the range [0, max) so that hosts sharing a schedule do not
+// all run at the same instant. A max of zero or less returns zero.
+func Jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	return rand.N(max)
+}
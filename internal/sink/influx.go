@@ -0,0 +1,141 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/primlock/zoomies/api"
+)
+
+// InfluxStdout is the destination that writes the line protocol to stdout.
+const InfluxStdout = "-"
+
+const influxMeasurement = "zoomies"
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// Influx writes the results of a run as a single point in InfluxDB line protocol. The destination
+// is either an HTTP write endpoint, "-" for stdout, or a file that the point is appended to.
+type Influx struct {
+	// An http(s) write endpoint including its query, e.g. http://localhost:8086/api/v2/write?org=o&bucket=b,
+	// "-" for stdout or the path of a file.
+	Destination string
+
+	// The token sent in the Authorization header when writing to an HTTP endpoint.
+	Token string
+
+	Client *http.Client
+	Stdout io.Writer
+}
+
+func NewInflux(destination, token string) *Influx {
+	return &Influx{Destination: destination, Token: token, Client: &http.Client{Timeout: HTTPTimeout}, Stdout: os.Stdout}
+}
+
+// Write encodes the result and sends it to the destination.
+func (i *Influx) Write(ctx context.Context, result *api.Result) error {
+	line := encodeLineProtocol(result)
+
+	switch {
+	case i.Destination == InfluxStdout:
+		_, err := io.WriteString(i.Stdout, line)
+		return err
+	case strings.HasPrefix(i.Destination, "http://"), strings.HasPrefix(i.Destination, "https://"):
+		return i.post(ctx, line)
+	default:
+		return appendFile(i.Destination, line)
+	}
+}
+
+func (i *Influx) post(ctx context.Context, line string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.Destination, strings.NewReader(line))
+	if err != nil {
+		return fmt.Errorf("failed to generate http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.Token != "" {
+		req.Header.Set("Authorization", "Token "+i.Token)
+	}
+
+	resp, err := i.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error writing to influxdb at %s: %w", i.Destination, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d from influxdb: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+func appendFile(path, data string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// resultTags returns the client and server attributes of a result as tag pairs, leaving out those
+// that are empty.
+func resultTags(result *api.Result) [][2]string {
+	all := [][2]string{
+		{"isp", result.Client.ISP},
+		{"client_city", result.Client.Location.City},
+		{"client_country", result.Client.Location.Country},
+		{"server", result.Server.Name},
+		{"server_city", result.Server.Location.City},
+		{"server_country", result.Server.Location.Country},
+	}
+
+	tags := make([][2]string, 0, len(all))
+	for _, t := range all {
+		if t[1] != "" {
+			tags = append(tags, t)
+		}
+	}
+
+	return tags
+}
+
+// encodeLineProtocol renders the result as one line protocol point with a field per metric.
+func encodeLineProtocol(result *api.Result) string {
+	var b strings.Builder
+	b.WriteString(influxMeasurementEscaper.Replace(influxMeasurement))
+
+	for _, t := range resultTags(result) {
+		fmt.Fprintf(&b, ",%s=%s", influxTagEscaper.Replace(t[0]), influxTagEscaper.Replace(t[1]))
+	}
+
+	for i, m := range Metrics(result) {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+
+		fmt.Fprintf(&b, "%s=%s", influxTagEscaper.Replace(m.Name), strconv.FormatFloat(m.Value, 'f', -1, 64))
+	}
+
+	fmt.Fprintf(&b, " %d\n", result.Timestamp.UnixNano())
+
+	return b.String()
+}
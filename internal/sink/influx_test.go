@@ -0,0 +1,87 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestEncodeLineProtocol(t *testing.T) {
+	result := newTestResult()
+	result.Client.ISP = "Example, Inc"
+	result.Server.Name = "lhr001"
+	result.Download = nil
+	result.Upload = nil
+	result.Latency.Jitter = 2 * time.Millisecond
+	result.Latency.PacketLoss = 25
+
+	got := encodeLineProtocol(result)
+	expected := `zoomies,isp=Example\,\ Inc,server=lhr001,server_city=London,server_country=GB latency_seconds=0.012,jitter_seconds=0.002,packet_loss_ratio=0.25,last_run_timestamp_seconds=1700000000 1700000000000000000` + "\n"
+
+	assert.Equal(t, got, expected)
+}
+
+func TestInfluxWrite(t *testing.T) {
+	t.Run("Stdout", func(t *testing.T) {
+		var out bytes.Buffer
+		i := NewInflux("-", "")
+		i.Stdout = &out
+
+		err := i.Write(context.Background(), newTestResult())
+		assert.NilError(t, err)
+		assert.Equal(t, out.String(), encodeLineProtocol(newTestResult()))
+	})
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "results.lp")
+		i := NewInflux(path, "")
+
+		assert.NilError(t, i.Write(context.Background(), newTestResult()))
+		assert.NilError(t, i.Write(context.Background(), newTestResult()))
+
+		b, err := os.ReadFile(path)
+		assert.NilError(t, err)
+		assert.Equal(t, string(b), encodeLineProtocol(newTestResult())+encodeLineProtocol(newTestResult()))
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		var auth, body string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			auth, body = r.Header.Get("Authorization"), string(b)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+
+		i := NewInflux(srv.URL+"/api/v2/write?org=o&bucket=b", "secret")
+
+		err := i.Write(context.Background(), newTestResult())
+		assert.NilError(t, err)
+		assert.Equal(t, auth, "Token secret")
+		assert.Equal(t, body, encodeLineProtocol(newTestResult()))
+	})
+
+	t.Run("HTTP timeout", func(t *testing.T) {
+		stalled := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-stalled
+		}))
+		defer srv.Close()
+		defer close(stalled)
+
+		i := NewInflux(srv.URL+"/api/v2/write?org=o&bucket=b", "")
+		assert.Equal(t, i.Client.Timeout, HTTPTimeout)
+
+		i.Client.Timeout = 50 * time.Millisecond
+		err := i.Write(context.Background(), newTestResult())
+		assert.ErrorContains(t, err, "Client.Timeout exceeded")
+	})
+}
@@ -0,0 +1,278 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+)
+
+const (
+	otlpServiceName      = "zoomies"
+	otlpScopeName        = "github.com/primlock/zoomies"
+	otlpRootSpanName     = "zoomies.run"
+	otlpMetricsPath      = "/v1/metrics"
+	otlpTracesPath       = "/v1/traces"
+	otlpSpanKindInternal = 1 // SPAN_KIND_INTERNAL
+	otlpStatusError      = 2 // STATUS_CODE_ERROR
+	otlpMetricPrefix     = "zoomies."
+	otlpMaxErrorBytes    = 512
+)
+
+// OTLP exports the metrics of a run, and the run itself as a trace, to an OpenTelemetry collector
+// using the JSON encoding of OTLP/HTTP.
+type OTLP struct {
+	// The base URL of the collector, e.g. http://localhost:4318. The signal paths are appended to it.
+	Endpoint string
+
+	// Additional headers sent with each request, such as authentication tokens.
+	Headers map[string]string
+
+	Client *http.Client
+}
+
+func NewOTLP(endpoint string, headers map[string]string) (*OTLP, error) {
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("error parsing otlp endpoint %s: %w", endpoint, err)
+	}
+
+	return &OTLP{Endpoint: strings.TrimRight(endpoint, "/"), Headers: headers, Client: &http.Client{Timeout: HTTPTimeout}}, nil
+}
+
+// Write sends the metrics and the trace of the result to the collector.
+func (o *OTLP) Write(ctx context.Context, result *api.Result) error {
+	errMetrics := o.post(ctx, otlpMetricsPath, otlpMetrics(result))
+
+	var errTraces error
+	if len(result.Phases) > 0 {
+		errTraces = o.post(ctx, otlpTracesPath, otlpTraces(result))
+	}
+
+	return errors.Join(errMetrics, errTraces)
+}
+
+func (o *OTLP) post(ctx context.Context, path string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode otlp payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to generate http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range o.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error exporting to %s: %w", req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, otlpMaxErrorBytes))
+		return fmt.Errorf("unexpected status code %d from %s: %s", resp.StatusCode, req.URL, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// The types below mirror the subset of the OTLP protobuf messages, in their JSON form, that
+// zoomies sends.
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	TimeUnixNano string         `json:"timeUnixNano"`
+	AsDouble     float64        `json:"asDouble"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Unit        string    `json:"unit,omitempty"`
+	Gauge       otlpGauge `json:"gauge"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTracesRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpResourceFor(result *api.Result) otlpResource {
+	return otlpResource{Attributes: []otlpKeyValue{
+		otlpString("service.name", otlpServiceName),
+		otlpString("client.isp", result.Client.ISP),
+		otlpString("client.city", result.Client.Location.City),
+		otlpString("client.country", result.Client.Location.Country),
+	}}
+}
+
+func otlpServerAttributes(result *api.Result) []otlpKeyValue {
+	return []otlpKeyValue{
+		otlpString("server.name", result.Server.Name),
+		otlpString("server.city", result.Server.Location.City),
+		otlpString("server.country", result.Server.Location.Country),
+	}
+}
+
+func otlpMetrics(result *api.Result) otlpMetricsRequest {
+	attrs := otlpServerAttributes(result)
+	ts := otlpTime(result.Timestamp)
+
+	var metrics []otlpMetric
+	for _, m := range Metrics(result) {
+		metrics = append(metrics, otlpMetric{
+			Name:        otlpMetricPrefix + m.Name,
+			Description: m.Help,
+			Unit:        m.Unit,
+			Gauge: otlpGauge{DataPoints: []otlpNumberDataPoint{
+				{Attributes: attrs, TimeUnixNano: ts, AsDouble: m.Value},
+			}},
+		})
+	}
+
+	return otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpResourceFor(result),
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: otlpScopeName}, Metrics: metrics}},
+	}}}
+}
+
+// otlpTraces builds a trace with a root span covering the whole run and a child span for each phase.
+func otlpTraces(result *api.Result) otlpTracesRequest {
+	traceID := randomHex(16)
+	rootID := randomHex(8)
+
+	start, end := result.Phases[0].Start, result.Phases[0].End
+	spans := make([]otlpSpan, 0, len(result.Phases)+1)
+
+	for _, p := range result.Phases {
+		if p.Start.Before(start) {
+			start = p.Start
+		}
+
+		if p.End.After(end) {
+			end = p.End
+		}
+
+		span := otlpSpan{
+			TraceID:           traceID,
+			SpanID:            randomHex(8),
+			ParentSpanID:      rootID,
+			Name:              p.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: otlpTime(p.Start),
+			EndTimeUnixNano:   otlpTime(p.End),
+		}
+
+		if p.Error != "" {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: p.Error}
+		}
+
+		spans = append(spans, span)
+	}
+
+	root := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            rootID,
+		Name:              otlpRootSpanName,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpTime(start),
+		EndTimeUnixNano:   otlpTime(end),
+		Attributes:        otlpServerAttributes(result),
+	}
+
+	return otlpTracesRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResourceFor(result),
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: otlpScopeName}, Spans: append([]otlpSpan{root}, spans...)}},
+	}}}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
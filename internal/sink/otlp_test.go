@@ -0,0 +1,88 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"gotest.tools/v3/assert"
+)
+
+func TestOTLPWrite(t *testing.T) {
+	var metrics otlpMetricsRequest
+	var traces otlpTracesRequest
+	var auth string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+
+		switch r.URL.Path {
+		case otlpMetricsPath:
+			_ = json.NewDecoder(r.Body).Decode(&metrics)
+		case otlpTracesPath:
+			_ = json.NewDecoder(r.Body).Decode(&traces)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	o, err := NewOTLP(srv.URL+"/", map[string]string{"Authorization": "Bearer secret"})
+	assert.NilError(t, err)
+
+	result := newTestResult()
+	start := result.Timestamp
+	result.Phases = []api.Phase{
+		{Name: "server_list", Start: start, End: start.Add(time.Second)},
+		{Name: "download", Start: start.Add(time.Second), End: start.Add(11 * time.Second), Error: "boom"},
+	}
+
+	err = o.Write(context.Background(), result)
+	assert.NilError(t, err)
+	assert.Equal(t, auth, "Bearer secret")
+
+	// Metrics
+	assert.Equal(t, len(metrics.ResourceMetrics), 1)
+	got := metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	assert.Equal(t, len(got), len(Metrics(result)))
+	assert.Equal(t, got[0].Name, "zoomies.latency_seconds")
+	assert.Equal(t, got[0].Gauge.DataPoints[0].AsDouble, 0.012)
+
+	// Traces
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Equal(t, len(spans), 3)
+
+	root := spans[0]
+	assert.Equal(t, root.Name, otlpRootSpanName)
+	assert.Equal(t, root.StartTimeUnixNano, otlpTime(start))
+	assert.Equal(t, root.EndTimeUnixNano, otlpTime(start.Add(11*time.Second)))
+
+	for _, s := range spans[1:] {
+		assert.Equal(t, s.TraceID, root.TraceID)
+		assert.Equal(t, s.ParentSpanID, root.SpanID)
+	}
+
+	assert.Equal(t, spans[2].Status.Code, otlpStatusError)
+	assert.Equal(t, spans[2].Status.Message, "boom")
+}
+
+func TestOTLPWriteTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer srv.Close()
+	defer close(stalled)
+
+	o, err := NewOTLP(srv.URL, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, o.Client.Timeout, HTTPTimeout)
+
+	o.Client.Timeout = 50 * time.Millisecond
+	err = o.Write(context.Background(), newTestResult())
+	assert.ErrorContains(t, err, "Client.Timeout exceeded")
+}
@@ -0,0 +1,136 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/primlock/zoomies/api"
+)
+
+const (
+	DefaultPushgatewayJob = "zoomies"
+	prometheusNamespace   = "zoomies"
+)
+
+var (
+	ErrPushgatewayJobEmpty  = errors.New("pushgateway job name must not be empty")
+	ErrPushgatewayLabelName = errors.New("pushgateway grouping label names must not be empty or job")
+)
+
+// Pushgateway pushes the metrics of a run to a Prometheus Pushgateway so that one-shot runs can be
+// collected from hosts that cannot be scraped.
+type Pushgateway struct {
+	// The base URL of the Pushgateway, e.g. http://localhost:9091.
+	URL string
+
+	// The job name the metrics are grouped under.
+	Job string
+
+	// Additional grouping labels appended to the job in the push path.
+	Labels map[string]string
+
+	Client *http.Client
+}
+
+func NewPushgateway(u, job string, labels map[string]string) (*Pushgateway, error) {
+	if job == "" {
+		return nil, ErrPushgatewayJobEmpty
+	}
+
+	// The job is the first label of the push path and cannot be set again.
+	for name := range labels {
+		if name == "" || name == "job" {
+			return nil, fmt.Errorf("%w: %q", ErrPushgatewayLabelName, name)
+		}
+	}
+
+	if _, err := url.Parse(u); err != nil {
+		return nil, fmt.Errorf("error parsing pushgateway url %s: %w", u, err)
+	}
+
+	return &Pushgateway{URL: u, Job: job, Labels: labels, Client: &http.Client{Timeout: HTTPTimeout}}, nil
+}
+
+// Write replaces the metrics held by the Pushgateway for this job and grouping with the result.
+func (p *Pushgateway) Write(ctx context.Context, result *api.Result) error {
+	var body bytes.Buffer
+	writeExposition(&body, result)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.groupingURL(), &body)
+	if err != nil {
+		return fmt.Errorf("failed to generate http request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error pushing metrics to %s: %w", p.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d from pushgateway: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// groupingURL builds the /metrics/job/<job>{/<label>/<value>} path used to group the push.
+func (p *Pushgateway) groupingURL() string {
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(p.URL, "/"))
+	b.WriteString("/metrics")
+	writePathLabel(&b, "job", p.Job)
+
+	keys := make([]string, 0, len(p.Labels))
+	for k := range p.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		writePathLabel(&b, k, p.Labels[k])
+	}
+
+	return b.String()
+}
+
+// writePathLabel appends a label pair to the push path. Values that cannot be represented as a
+// path segment are base64 encoded as described by the Pushgateway API, which writes an empty value
+// as "=".
+func writePathLabel(b *strings.Builder, name, value string) {
+	if value == "" {
+		fmt.Fprintf(b, "/%s@base64/=", name)
+		return
+	}
+
+	if strings.Contains(value, "/") {
+		fmt.Fprintf(b, "/%s@base64/%s", name, base64.RawURLEncoding.EncodeToString([]byte(value)))
+		return
+	}
+
+	fmt.Fprintf(b, "/%s/%s", name, url.PathEscape(value))
+}
+
+// writeExposition renders the metrics of a result in the Prometheus text exposition format.
+func writeExposition(w io.Writer, result *api.Result) {
+	labels := fmt.Sprintf(`{server=%q,city=%q,country=%q}`,
+		result.Server.Name, result.Server.Location.City, result.Server.Location.Country)
+
+	for _, m := range Metrics(result) {
+		name := prometheusNamespace + "_" + m.Name
+		fmt.Fprintf(w, "# HELP %s %s\n", name, m.Help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(w, "%s%s %g\n", name, labels, m.Value)
+	}
+}
@@ -0,0 +1,148 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"gotest.tools/v3/assert"
+)
+
+func newTestResult() *api.Result {
+	r := &api.Result{
+		Timestamp: time.Unix(1700000000, 0),
+		Server:    api.Server{Name: "https://ipv4-c001-lhr001-isp1.oca.nflxvideo.net/speedtest"},
+		Latency:   &api.LatencyResult{Ping: 12 * time.Millisecond},
+		Download:  &api.TransferResult{Bytes: 125000000, Duration: 10 * time.Second},
+		Upload:    &api.TransferResult{Bytes: 25000000, Duration: 10 * time.Second},
+	}
+	r.Server.Location.City = "London"
+	r.Server.Location.Country = "GB"
+	return r
+}
+
+func TestPushgatewayGroupingURL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		url      string
+		job      string
+		labels   map[string]string
+		expected string
+	}{
+		{
+			name:     "Job only",
+			url:      "http://localhost:9091",
+			job:      "zoomies",
+			expected: "http://localhost:9091/metrics/job/zoomies",
+		},
+		{
+			name:     "Labels are sorted",
+			url:      "http://localhost:9091/",
+			job:      "zoomies",
+			labels:   map[string]string{"site": "lon", "instance": "edge1"},
+			expected: "http://localhost:9091/metrics/job/zoomies/instance/edge1/site/lon",
+		},
+		{
+			name:     "Values containing a slash are base64 encoded",
+			url:      "http://localhost:9091",
+			job:      "zoomies",
+			labels:   map[string]string{"path": "a/b"},
+			expected: "http://localhost:9091/metrics/job/zoomies/path@base64/YS9i",
+		},
+		{
+			name:     "Empty values are encoded as an equals sign",
+			url:      "http://localhost:9091",
+			job:      "zoomies",
+			labels:   map[string]string{"site": ""},
+			expected: "http://localhost:9091/metrics/job/zoomies/site@base64/=",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPushgateway(tt.url, tt.job, tt.labels)
+			assert.NilError(t, err)
+			assert.Equal(t, p.groupingURL(), tt.expected)
+		})
+	}
+}
+
+func TestPushgatewayWrite(t *testing.T) {
+	var method, path, body string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	p, err := NewPushgateway(srv.URL, "zoomies", map[string]string{"instance": "edge1"})
+	assert.NilError(t, err)
+
+	err = p.Write(context.Background(), newTestResult())
+	assert.NilError(t, err)
+
+	assert.Equal(t, method, http.MethodPut)
+	assert.Equal(t, path, "/metrics/job/zoomies/instance/edge1")
+	assert.Assert(t, strings.Contains(body, "# TYPE zoomies_download_bits_per_second gauge\n"))
+	assert.Assert(t, strings.Contains(body, `zoomies_download_bits_per_second{server="https://ipv4-c001-lhr001-isp1.oca.nflxvideo.net/speedtest",city="London",country="GB"} 1e+08`))
+	assert.Assert(t, strings.Contains(body, "zoomies_latency_seconds{"))
+}
+
+func TestPushgatewayWriteError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metric", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	p, err := NewPushgateway(srv.URL, "zoomies", nil)
+	assert.NilError(t, err)
+
+	err = p.Write(context.Background(), newTestResult())
+	assert.Error(t, err, "unexpected status code 400 from pushgateway: bad metric")
+}
+
+func TestPushgatewayWriteTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer srv.Close()
+	defer close(stalled)
+
+	p, err := NewPushgateway(srv.URL, "zoomies", nil)
+	assert.NilError(t, err)
+	assert.Equal(t, p.Client.Timeout, HTTPTimeout)
+
+	p.Client.Timeout = 50 * time.Millisecond
+	err = p.Write(context.Background(), newTestResult())
+	assert.ErrorContains(t, err, "Client.Timeout exceeded")
+}
+
+func TestNewPushgatewayEmptyJob(t *testing.T) {
+	_, err := NewPushgateway("http://localhost:9091", "", nil)
+	assert.Error(t, err, ErrPushgatewayJobEmpty.Error())
+}
+
+func TestNewPushgatewayInvalidLabelName(t *testing.T) {
+	testCases := []struct {
+		name   string
+		labels map[string]string
+	}{
+		{name: "Job label", labels: map[string]string{"job": "other"}},
+		{name: "Empty label name", labels: map[string]string{"": "lon"}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPushgateway("http://localhost:9091", "zoomies", tt.labels)
+			assert.ErrorIs(t, err, ErrPushgatewayLabelName)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+)
+
+// HTTPTimeout bounds each request of the sinks that write over HTTP, so that an endpoint that
+// accepts the connection but never answers does not hang the run.
+const HTTPTimeout = 10 * time.Second
+
+// Sink is a destination that the results of a test run are written to once the run finishes.
+type Sink interface {
+	Write(ctx context.Context, result *api.Result) error
+}
+
+// Metric is a single named measurement derived from a test result.
+type Metric struct {
+	Name  string
+	Help  string
+	Unit  string
+	Value float64
+}
+
+// Metrics converts a result into the set of metrics every sink reports. Tests that were skipped
+// during the run are left out of the set.
+func Metrics(result *api.Result) []Metric {
+	var metrics []Metric
+
+	if result.Latency != nil {
+		metrics = append(metrics,
+			Metric{
+				Name:  "latency_seconds",
+				Help:  "Average round-trip time to the test server.",
+				Unit:  "s",
+				Value: result.Latency.Ping.Seconds(),
+			},
+			Metric{
+				Name:  "jitter_seconds",
+				Help:  "Standard deviation of the round-trip times to the test server.",
+				Unit:  "s",
+				Value: result.Latency.Jitter.Seconds(),
+			},
+			Metric{
+				Name:  "packet_loss_ratio",
+				Help:  "Fraction of pings to the test server that received no reply.",
+				Unit:  "1",
+				Value: result.Latency.PacketLoss / 100,
+			},
+		)
+	}
+
+	if result.Download != nil {
+		metrics = append(metrics,
+			Metric{
+				Name:  "download_bits_per_second",
+				Help:  "Average download rate measured during the test.",
+				Unit:  "bit/s",
+				Value: result.Download.BitsPerSecond(),
+			},
+			Metric{
+				Name:  "download_bytes",
+				Help:  "Number of bytes read during the download test.",
+				Unit:  "By",
+				Value: float64(result.Download.Bytes),
+			},
+		)
+	}
+
+	if result.Upload != nil {
+		metrics = append(metrics,
+			Metric{
+				Name:  "upload_bits_per_second",
+				Help:  "Average upload rate measured during the test.",
+				Unit:  "bit/s",
+				Value: result.Upload.BitsPerSecond(),
+			},
+			Metric{
+				Name:  "upload_bytes",
+				Help:  "Number of bytes written during the upload test.",
+				Unit:  "By",
+				Value: float64(result.Upload.Bytes),
+			},
+		)
+	}
+
+	metrics = append(metrics, Metric{
+		Name:  "last_run_timestamp_seconds",
+		Help:  "Unix time the test run started.",
+		Unit:  "s",
+		Value: float64(result.Timestamp.UnixNano()) / float64(time.Second),
+	})
+
+	return metrics
+}
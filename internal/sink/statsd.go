@@ -0,0 +1,80 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/primlock/zoomies/api"
+)
+
+const DefaultStatsDPrefix = "zoomies"
+
+var statsdTagEscaper = strings.NewReplacer(",", "_", "|", "_", ":", "_", "#", "_")
+
+// StatsD emits the metrics of a run as StatsD gauges over UDP.
+type StatsD struct {
+	// The host:port of the StatsD daemon.
+	Addr string
+
+	// The prefix prepended to each gauge name.
+	Prefix string
+
+	// Append the client and server attributes to each gauge using the DogStatsD tag extension.
+	Tags bool
+}
+
+func NewStatsD(addr, prefix string, tags bool) (*StatsD, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("error parsing statsd address %s: %w", addr, err)
+	}
+
+	return &StatsD{Addr: addr, Prefix: prefix, Tags: tags}, nil
+}
+
+// Write sends a gauge for each metric in a single datagram.
+func (s *StatsD) Write(ctx context.Context, result *api.Result) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to statsd at %s: %w", s.Addr, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(s.encode(result))); err != nil {
+		return fmt.Errorf("error sending metrics to statsd at %s: %w", s.Addr, err)
+	}
+
+	return nil
+}
+
+// encode renders the result as newline separated gauges, e.g. zoomies.download_bits_per_second:100000000|g.
+func (s *StatsD) encode(result *api.Result) string {
+	var suffix string
+	if s.Tags {
+		tags := resultTags(result)
+		pairs := make([]string, len(tags))
+		for i, t := range tags {
+			pairs[i] = t[0] + ":" + statsdTagEscaper.Replace(t[1])
+		}
+
+		if len(pairs) > 0 {
+			suffix = "|#" + strings.Join(pairs, ",")
+		}
+	}
+
+	metrics := Metrics(result)
+	lines := make([]string, len(metrics))
+	for i, m := range metrics {
+		name := m.Name
+		if s.Prefix != "" {
+			name = s.Prefix + "." + name
+		}
+
+		lines[i] = fmt.Sprintf("%s:%s|g%s", name, strconv.FormatFloat(m.Value, 'f', -1, 64), suffix)
+	}
+
+	return strings.Join(lines, "\n")
+}
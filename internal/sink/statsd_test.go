@@ -0,0 +1,68 @@
+package sink
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestStatsDEncode(t *testing.T) {
+	result := newTestResult()
+	result.Client.ISP = "Example, Inc"
+	result.Download = nil
+	result.Upload = nil
+
+	testCases := []struct {
+		name     string
+		statsd   StatsD
+		expected string
+	}{
+		{
+			name:   "Without tags",
+			statsd: StatsD{Prefix: "zoomies"},
+			expected: "zoomies.latency_seconds:0.012|g\n" +
+				"zoomies.jitter_seconds:0|g\n" +
+				"zoomies.packet_loss_ratio:0|g\n" +
+				"zoomies.last_run_timestamp_seconds:1700000000|g",
+		},
+		{
+			name:   "With tags",
+			statsd: StatsD{Prefix: "", Tags: true},
+			expected: "latency_seconds:0.012|g|#isp:Example_ Inc,server:https_//ipv4-c001-lhr001-isp1.oca.nflxvideo.net/speedtest,server_city:London,server_country:GB\n" +
+				"jitter_seconds:0|g|#isp:Example_ Inc,server:https_//ipv4-c001-lhr001-isp1.oca.nflxvideo.net/speedtest,server_city:London,server_country:GB\n" +
+				"packet_loss_ratio:0|g|#isp:Example_ Inc,server:https_//ipv4-c001-lhr001-isp1.oca.nflxvideo.net/speedtest,server_city:London,server_country:GB\n" +
+				"last_run_timestamp_seconds:1700000000|g|#isp:Example_ Inc,server:https_//ipv4-c001-lhr001-isp1.oca.nflxvideo.net/speedtest,server_city:London,server_country:GB",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.statsd.encode(result), tt.expected)
+		})
+	}
+}
+
+func TestStatsDWrite(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer conn.Close()
+
+	s, err := NewStatsD(conn.LocalAddr().String(), DefaultStatsDPrefix, false)
+	assert.NilError(t, err)
+
+	err = s.Write(context.Background(), newTestResult())
+	assert.NilError(t, err)
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NilError(t, err)
+
+	lines := strings.Split(string(buf[:n]), "\n")
+	assert.Equal(t, len(lines), len(Metrics(newTestResult())))
+	assert.Equal(t, lines[3], "zoomies.download_bits_per_second:100000000|g")
+}
@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"math"
+	"slices"
+)
+
+// Summary describes the spread of a set of samples.
+type Summary struct {
+	Count  int     `json:"count"`
+	P10    float64 `json:"p10"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+}
+
+// Summarize returns the 10th percentile, median and 90th percentile of the values.
+func Summarize(values []float64) Summary {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	return Summary{
+		Count:  len(sorted),
+		P10:    percentile(sorted, 10),
+		Median: percentile(sorted, 50),
+		P90:    percentile(sorted, 90),
+	}
+}
+
+// Percentile returns the p-th percentile (0-100) of the values, interpolating linearly between the
+// closest ranks. An empty set returns NaN.
+func Percentile(values []float64, p float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	return percentile(sorted, p)
+}
+
+// Median returns the middle value of the values.
+func Median(values []float64) float64 {
+	return Percentile(values, 50)
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"math"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		values   []float64
+		p        float64
+		expected float64
+	}{
+		{name: "Single value", values: []float64{4}, p: 90, expected: 4},
+		{name: "Median of an odd count", values: []float64{3, 1, 2}, p: 50, expected: 2},
+		{name: "Median of an even count", values: []float64{4, 1, 3, 2}, p: 50, expected: 2.5},
+		{name: "Interpolated 10th percentile", values: []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110}, p: 10, expected: 20},
+		{name: "Interpolated 90th percentile", values: []float64{1, 2, 3, 4, 5}, p: 90, expected: 4.6},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Percentile(tt.values, tt.p)
+			assert.Assert(t, math.Abs(got-tt.expected) < 1e-9, "got %v, want %v", got, tt.expected)
+		})
+	}
+}
+
+func TestPercentileEmpty(t *testing.T) {
+	assert.Assert(t, math.IsNaN(Median(nil)))
+}
+
+func TestSummarize(t *testing.T) {
+	values := []float64{5, 1, 4, 2, 3}
+	got := Summarize(values)
+
+	assert.Equal(t, got.Count, 5)
+	assert.Equal(t, got.Median, 3.0)
+	assert.DeepEqual(t, values, []float64{5, 1, 4, 2, 3})
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	"os"
 
 	"github.com/primlock/zoomies/cmd"
 )
@@ -10,6 +10,6 @@ func main() {
 	zoomies := cmd.NewCmd()
 	err := zoomies.Execute()
 	if err != nil {
-		log.Fatal(err)
+		os.Exit(cmd.ExitCode(err))
 	}
 }
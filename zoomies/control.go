@@ -0,0 +1,161 @@
+package zoomies
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/primlock/zoomies/api"
+)
+
+var (
+	ErrAborted = errors.New("the run was aborted")
+	ErrSkipped = errors.New("skipped")
+)
+
+// Control steers a run while it goes on, such as from key presses. Pass it in the options of the
+// run; its methods may be called from any goroutine and do nothing outside a run.
+type Control struct {
+	mu          sync.Mutex
+	connections int
+	aborted     bool
+	cancel      context.CancelCauseFunc
+
+	// The phase that can be skipped and the transfer that is running, if any.
+	skip     func()
+	transfer *api.TransferControl
+}
+
+func NewControl() *Control {
+	return &Control{}
+}
+
+// Skip ends the latency, download or upload phase that is running. A skipped transfer keeps what
+// it measured so far and a skipped latency test is reported as a warning.
+func (c *Control) Skip() {
+	c.mu.Lock()
+	skip := c.skip
+	c.mu.Unlock()
+
+	if skip != nil {
+		skip()
+	}
+}
+
+// Abort ends the run, which returns ErrAborted with the results measured so far. A transfer that
+// is running is stopped like Skip so that its result is kept.
+func (c *Control) Abort() {
+	c.mu.Lock()
+	c.aborted = true
+	transfer, cancel := c.transfer, c.cancel
+	c.mu.Unlock()
+
+	switch {
+	case transfer != nil:
+		transfer.Stop()
+	case cancel != nil:
+		cancel(ErrAborted)
+	}
+}
+
+// AddConnection adds a concurrent request to the download or upload test that is running and to
+// those that follow, up to MaxConnections.
+func (c *Control) AddConnection() {
+	c.setConnections(1)
+}
+
+// RemoveConnection removes a concurrent request like AddConnection, keeping at least one.
+func (c *Control) RemoveConnection() {
+	c.setConnections(-1)
+}
+
+// Connections returns the number of concurrent requests of the download and upload tests.
+func (c *Control) Connections() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.connections
+}
+
+func (c *Control) setConnections(delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.connections = min(max(c.connections+delta, 1), MaxConnections)
+	if c.transfer != nil {
+		c.transfer.SetRequests(c.connections)
+	}
+}
+
+// start attaches the control to a run with the number of connections of the options. The cancel
+// function ends the run when it is aborted.
+func (c *Control) start(connections int, cancel context.CancelCauseFunc) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.connections, c.cancel = connections, cancel
+	if c.aborted {
+		cancel(ErrAborted)
+	}
+}
+
+// isAborted reports whether the run was aborted.
+func (c *Control) isAborted() bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.aborted
+}
+
+// skippable returns a context that ends with ErrSkipped as its cause when the phase is skipped,
+// and a function that releases it once the phase is over.
+func (c *Control) skippable(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	if c == nil {
+		return ctx, func() { cancel(nil) }
+	}
+
+	c.mu.Lock()
+	c.skip = func() { cancel(ErrSkipped) }
+	c.mu.Unlock()
+
+	return ctx, func() {
+		c.mu.Lock()
+		c.skip = nil
+		c.mu.Unlock()
+
+		cancel(nil)
+	}
+}
+
+// newTransfer returns the control of a transfer with the current number of connections, which
+// is skipped, aborted and resized through the control, and a function that releases it once the
+// transfer is over.
+func (c *Control) newTransfer(connections int) (*api.TransferControl, func()) {
+	if c == nil {
+		return api.NewTransferControl(connections), func() {}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tc := api.NewTransferControl(c.connections)
+	c.transfer, c.skip = tc, tc.Stop
+	if c.aborted {
+		tc.Stop()
+	}
+
+	return tc, func() {
+		c.mu.Lock()
+		c.transfer, c.skip = nil, nil
+		c.mu.Unlock()
+	}
+}
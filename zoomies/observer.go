@@ -0,0 +1,72 @@
+package zoomies
+
+import (
+	"time"
+
+	"github.com/primlock/zoomies/api"
+)
+
+// Observer is told about the progress of a run so that it can be shown while the run goes on. The
+// calls are made one at a time and should return quickly, since the run waits for them.
+type Observer interface {
+	// OnPhaseStart is called when the named phase starts. The target is the server under test, or
+	// nil before one has been selected.
+	OnPhaseStart(phase string, target *Target)
+
+	// OnSample is called with each round-trip time of the latency phase and with the progress of
+	// the download and upload phases every api.ProgressInterval. The round-trip times of the loaded
+	// latency are passed to the download and upload phases too when they are measured.
+	OnSample(phase string, sample Sample)
+
+	// OnPhaseEnd is called when the named phase ends, with the error it failed with.
+	OnPhaseEnd(phase string, err error)
+
+	// OnWarning is called with a problem that does not fail the run. It is kept in the warnings of
+	// the report too.
+	OnWarning(msg string)
+}
+
+// Target is the server under test and the client testing it.
+type Target struct {
+	Client api.Client
+	Server api.Server
+}
+
+// Sample is a measurement taken during a phase.
+type Sample struct {
+	// The time since the phase started.
+	Elapsed time.Duration
+
+	// The bytes moved so far by a download or upload phase and the requests in flight.
+	Bytes       uint64
+	Connections int
+
+	// A round-trip time of the latency phase, or of the loaded latency measured during a download
+	// or upload phase, and the method it was measured with. Lost is set instead for a probe that got
+	// no reply.
+	RTT    time.Duration
+	Method string
+	Lost   bool
+}
+
+// IsRTT reports whether the sample is a round-trip time rather than the progress of a transfer.
+func (s Sample) IsRTT() bool {
+	return s.RTT > 0 || s.Lost
+}
+
+// BitsPerSecond returns the rate the bytes of the sample were moved at.
+func (s Sample) BitsPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(s.Bytes*8) / s.Elapsed.Seconds()
+}
+
+// nopObserver is used when the options have no observer.
+type nopObserver struct{}
+
+func (nopObserver) OnPhaseStart(phase string, target *Target) {}
+func (nopObserver) OnSample(phase string, sample Sample)      {}
+func (nopObserver) OnPhaseEnd(phase string, err error)        {}
+func (nopObserver) OnWarning(msg string)                      {}
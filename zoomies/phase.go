@@ -0,0 +1,233 @@
+package zoomies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/logger"
+	"github.com/primlock/zoomies/internal/retry"
+)
+
+var (
+	ErrPhaseTimeout = errors.New("timed out")
+	ErrRunTimeout   = errors.New("the run exceeded its time budget (see --timeout)")
+)
+
+const (
+	PhaseTokenDiscovery   = "token_discovery"
+	PhaseServerList       = "server_list"
+	PhaseCandidateProbing = "candidate_probing"
+	PhaseLatency          = "latency"
+	PhaseDownload         = "download"
+	PhaseUpload           = "upload"
+)
+
+const (
+	TokenDiscoveryTimeout   = 20 * time.Second
+	ServerListTimeout       = 15 * time.Second
+	CandidateProbingTimeout = 30 * time.Second
+
+	// The time a phase may run past its expected length before it is considered hung.
+	PhaseGracePeriod = 10 * time.Second
+)
+
+// phaseRecorder keeps the timings of each stage of a run, the number of retries it took and the
+// problems that did not fail it so they can be exported with the results, and tells the observer
+// about them. A nil recorder runs the stages without recording them.
+type phaseRecorder struct {
+	phases   []api.Phase
+	retries  atomic.Int64
+	warnings []string
+
+	// The observer is called under the lock, and only with the samples of the active phase so that
+	// a phase abandoned by track cannot report after it ended.
+	mu       sync.Mutex
+	observer Observer
+	active   string
+	target   *Target
+}
+
+func newPhaseRecorder(observer Observer) *phaseRecorder {
+	if observer == nil {
+		observer = nopObserver{}
+	}
+
+	return &phaseRecorder{observer: observer}
+}
+
+// notify calls fn with the observer, if there is one.
+func (r *phaseRecorder) notify(fn func(o Observer)) {
+	if r == nil || r.observer == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fn(r.observer)
+}
+
+// setTarget sets the server under test that is passed to the observer as each phase starts.
+func (r *phaseRecorder) setTarget(target *Target) {
+	if r != nil {
+		r.target = target
+	}
+}
+
+// sample passes a sample of the named phase to the observer while the phase is active.
+func (r *phaseRecorder) sample(phase string, s Sample) {
+	r.notify(func(o Observer) {
+		if r.active == phase {
+			o.OnSample(phase, s)
+		}
+	})
+}
+
+// retried counts a retry made during the run.
+func (r *phaseRecorder) retried() {
+	if r != nil {
+		r.retries.Add(1)
+	}
+}
+
+// warn records a problem that did not fail the run and logs it with the fields of the context.
+func (r *phaseRecorder) warn(ctx context.Context, msg string) {
+	logger.FromContext(ctx).Warn(msg)
+
+	if r != nil {
+		r.warnings = append(r.warnings, msg)
+	}
+
+	r.notify(func(o Observer) { o.OnWarning(msg) })
+}
+
+// retryCount returns the number of retries made during the run.
+func (r *phaseRecorder) retryCount() int {
+	if r == nil {
+		return 0
+	}
+
+	return int(r.retries.Load())
+}
+
+// trackRetries runs fn as the named phase like track, retrying it with backoff under the policy.
+// Every attempt shares the timeout of the phase.
+func (r *phaseRecorder) trackRetries(ctx context.Context, name string, timeout time.Duration, policy retry.Policy, fn func(ctx context.Context) error) error {
+	return r.track(ctx, name, timeout, func(ctx context.Context) error {
+		return retryWithLog(ctx, policy, r, name+" phase", fn)
+	})
+}
+
+// retryWithLog runs fn under the policy, counting and logging each retry of the operation.
+func retryWithLog(ctx context.Context, policy retry.Policy, rec *phaseRecorder, operation string, fn func(ctx context.Context) error) error {
+	attempt := 0
+	var last error
+
+	return retry.Do(ctx, policy, func(ctx context.Context) error {
+		if attempt > 0 {
+			rec.retried()
+			logger.FromContext(ctx).Warn("retrying "+operation, "error", last, "retry", attempt, "retries", policy.Attempts-1)
+		}
+
+		attempt++
+		last = fn(ctx)
+
+		return last
+	})
+}
+
+// track runs fn as the named phase and records how long it took and whether it failed. The phase
+// is given a context that logs with the name of the phase and ends after the timeout or with the
+// run. When it ends, track returns without waiting for fn so that a call that ignores the context
+// cannot hang the run.
+func (r *phaseRecorder) track(ctx context.Context, name string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx = logger.With(ctx, logger.KeyPhase, name)
+	start := time.Now()
+	r.notify(func(o Observer) {
+		r.active = name
+		o.OnPhaseStart(name, r.target)
+	})
+
+	err := runPhase(ctx, name, timeout, fn)
+	if err != nil {
+		logger.FromContext(ctx).Debug("phase failed", "duration", time.Since(start), "error", err)
+	} else {
+		logger.FromContext(ctx).Debug("phase finished", "duration", time.Since(start))
+	}
+
+	r.notify(func(o Observer) {
+		r.active = ""
+		o.OnPhaseEnd(name, err)
+	})
+
+	if r != nil {
+		p := api.Phase{Name: name, Start: start, End: time.Now()}
+		if err != nil {
+			p.Error = err.Error()
+		}
+
+		r.phases = append(r.phases, p)
+	}
+
+	return err
+}
+
+func runPhase(ctx context.Context, name string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	phaseCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- fn(phaseCtx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-phaseCtx.Done():
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%s phase: %w", name, ErrRunTimeout)
+	case ctx.Err() != nil:
+		return fmt.Errorf("%s phase: %w", name, ctx.Err())
+	case errors.Is(phaseCtx.Err(), context.DeadlineExceeded) && (err == nil || errors.Is(err, context.DeadlineExceeded)):
+		return fmt.Errorf("%s phase %w after %s", name, ErrPhaseTimeout, timeout)
+	}
+
+	return err
+}
+
+// candidateProbingTimeout returns the time the candidate probing phase is allowed to take. Ranking
+// by throughput downloads from each candidate in turn, so the phase is given the length of every
+// pre-test when that is longer.
+func candidateProbingTimeout(opts *Options, candidates int) time.Duration {
+	timeout := phaseTimeout(PhaseCandidateProbing, opts)
+	if opts.Selection.Rank != RankThroughput {
+		return timeout
+	}
+
+	return max(timeout, time.Duration(candidates)*PreTestDuration+PhaseGracePeriod)
+}
+
+// phaseTimeout returns the time the named phase is allowed to take with the options.
+func phaseTimeout(name string, opts *Options) time.Duration {
+	switch name {
+	case PhaseTokenDiscovery:
+		return TokenDiscoveryTimeout
+	case PhaseServerList:
+		return ServerListTimeout
+	case PhaseCandidateProbing:
+		return CandidateProbingTimeout
+	case PhaseLatency:
+		return time.Duration(opts.Pings)*time.Second + api.ICMPReplyTimeout + PhaseGracePeriod
+	case PhaseDownload, PhaseUpload:
+		return opts.Duration + PhaseGracePeriod
+	}
+
+	return PhaseGracePeriod
+}
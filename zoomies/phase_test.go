@@ -0,0 +1,79 @@
+package zoomies
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPhaseTimeouts(t *testing.T) {
+	errProbe := errors.New("probe failed")
+	block := func(ctx context.Context) error { select {} }
+	wait := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	testCases := []struct {
+		name     string
+		run      time.Duration
+		phase    time.Duration
+		fn       func(ctx context.Context) error
+		expected error
+		message  string
+	}{
+		{name: "Phase finishes in time", run: time.Second, phase: time.Second, fn: func(ctx context.Context) error { return nil }},
+		{name: "Phase error is returned", run: time.Second, phase: time.Second, fn: func(ctx context.Context) error { return errProbe }, expected: errProbe},
+		{name: "Phase honours its timeout", run: time.Second, phase: 10 * time.Millisecond, fn: wait, expected: ErrPhaseTimeout, message: "download phase timed out after 10ms"},
+		{name: "Phase ignores its timeout", run: time.Second, phase: 10 * time.Millisecond, fn: block, expected: ErrPhaseTimeout},
+		{name: "Run deadline passes first", run: 10 * time.Millisecond, phase: time.Second, fn: block, expected: ErrRunTimeout, message: "download phase: the run exceeded its time budget (see --timeout)"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.run)
+			defer cancel()
+
+			rec := &phaseRecorder{}
+			err := rec.track(ctx, PhaseDownload, tt.phase, tt.fn)
+
+			if tt.expected == nil {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expected)
+			}
+
+			if tt.message != "" {
+				assert.Error(t, err, tt.message)
+			}
+
+			assert.Equal(t, len(rec.phases), 1)
+			assert.Equal(t, rec.phases[0].Name, PhaseDownload)
+		})
+	}
+}
+
+func TestCandidateProbingTimeout(t *testing.T) {
+	testCases := []struct {
+		name       string
+		rank       string
+		candidates int
+		expected   time.Duration
+	}{
+		{name: "Ranked by round-trip time", rank: RankRTT, candidates: 20, expected: CandidateProbingTimeout},
+		{name: "Few candidates ranked by throughput", rank: RankThroughput, candidates: 3, expected: CandidateProbingTimeout},
+		{name: "Many candidates ranked by throughput", rank: RankThroughput, candidates: 20, expected: 20*PreTestDuration + PhaseGracePeriod},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Selection.Rank = tt.rank
+
+			assert.Equal(t, candidateProbingTimeout(&opts, tt.candidates), tt.expected)
+		})
+	}
+}
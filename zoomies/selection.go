@@ -0,0 +1,333 @@
+package zoomies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/logger"
+)
+
+var (
+	ErrPinnedServerNotFound   = errors.New("no server matches --server")
+	ErrNoServersMatch         = errors.New("no servers are left after applying --country, --city and --exclude")
+	ErrUnknownRankStrategy    = errors.New("rank must be one of rtt or throughput")
+	ErrRankSamplesOutOfBounds = errors.New("rank samples must be in the range 1-10 inclusive")
+)
+
+const (
+	RankRTT        = "rtt"
+	RankThroughput = "throughput"
+
+	DefaultRankStrategy = RankRTT
+	DefaultRankSamples  = 3
+	MaxRankSamples      = 10
+
+	// The time the probes of a candidate may take on top of a second for each sample before the
+	// candidate is considered unreachable, long enough for unanswered pings to fall back to TCP.
+	ProbeTimeout = 8 * time.Second
+
+	// The length of the download used to rank each candidate by throughput.
+	PreTestDuration = 2 * time.Second
+)
+
+// The time allowed for each sample of a candidate and on top of them, shortened in tests.
+var (
+	probeSampleTime = time.Second
+	probeTimeout    = ProbeTimeout
+)
+
+// Selection controls which of the servers handed out by fast.com are tested.
+type Selection struct {
+	// A server to test regardless of the ranking, given by name, host or its 1-based index in the
+	// server list.
+	Pin string
+
+	// Only servers in these countries or cities.
+	Countries []string
+	Cities    []string
+
+	// Servers whose name or host is listed here are skipped.
+	Exclude []string
+
+	// How the candidates are ranked: rtt (or median, another name for it) or throughput.
+	Rank string
+
+	// The number of probes the median round-trip time of each candidate is taken over.
+	RankSamples int
+}
+
+// DefaultSelection returns a selection that ranks every server by round-trip time.
+func DefaultSelection() Selection {
+	return Selection{
+		Rank:        DefaultRankStrategy,
+		RankSamples: DefaultRankSamples,
+	}
+}
+
+// validate checks the ranking options.
+func (sel *Selection) validate() error {
+	if !slices.Contains([]string{RankRTT, RankThroughput}, sel.Rank) {
+		return ErrUnknownRankStrategy
+	}
+
+	if sel.RankSamples < 1 || sel.RankSamples > MaxRankSamples {
+		return ErrRankSamplesOutOfBounds
+	}
+
+	return nil
+}
+
+// filter returns the servers left after the filters and exclusions, or only the pinned server.
+// The pinned server takes precedence over the filters.
+func (sel *Selection) filter(ctx context.Context, servers []api.Server) ([]api.Server, error) {
+	if sel.Pin != "" {
+		s, err := pinServer(servers, sel.Pin)
+		if err != nil {
+			return nil, err
+		}
+
+		return []api.Server{s}, nil
+	}
+
+	var kept []api.Server
+	for _, s := range servers {
+		if len(sel.Countries) > 0 && !containsFold(sel.Countries, s.Location.Country) {
+			continue
+		}
+
+		if len(sel.Cities) > 0 && !containsFold(sel.Cities, s.Location.City) {
+			continue
+		}
+
+		if containsFold(sel.Exclude, s.Name) || containsFold(sel.Exclude, serverHost(s)) {
+			logger.FromContext(ctx).Info("excluding server", logger.KeyServer, s.Name)
+			continue
+		}
+
+		kept = append(kept, s)
+	}
+
+	if len(kept) == 0 {
+		return nil, ErrNoServersMatch
+	}
+
+	return kept, nil
+}
+
+// pinServer finds the server with the name or host, or at the 1-based index in the list.
+func pinServer(servers []api.Server, pin string) (api.Server, error) {
+	if i, err := strconv.Atoi(pin); err == nil {
+		if i < 1 || i > len(servers) {
+			return api.Server{}, fmt.Errorf("%w: index %d is outside the list of %d servers", ErrPinnedServerNotFound, i, len(servers))
+		}
+
+		return servers[i-1], nil
+	}
+
+	names := make([]string, len(servers))
+	for i, s := range servers {
+		if strings.EqualFold(s.Name, pin) || strings.EqualFold(serverHost(s), pin) {
+			return s, nil
+		}
+
+		names[i] = s.Name
+	}
+
+	return api.Server{}, fmt.Errorf("%w: %q is not one of %s", ErrPinnedServerNotFound, pin, strings.Join(names, ", "))
+}
+
+// rank returns the best count servers by the ranking strategy, measuring round-trip times with the
+// prober. A single candidate is returned without being probed.
+func (sel *Selection) rank(ctx context.Context, candidates []api.Server, count int, prober api.Prober) ([]api.Server, error) {
+	if len(candidates) == 1 {
+		return candidates, nil
+	}
+
+	if sel.Rank == RankThroughput {
+		return getHighestThroughputServers(ctx, candidates, count, PreTestDuration)
+	}
+
+	return getLowestRTTServers(ctx, candidates, count, sel.RankSamples, prober)
+}
+
+// Candidate is a server with the round-trip time it was ranked by.
+type Candidate struct {
+	Server api.Server
+	RTT    time.Duration
+
+	// The probe method the RTT was measured with.
+	Method string
+}
+
+// getLowestRTTServers probes the candidates concurrently and returns the count servers with the
+// lowest median round-trip time over the number of samples. Each sample is bounded by the probe
+// timeout, and candidates that answer none of their samples are excluded rather than failing the
+// selection. Round-trip times measured by different methods are not comparable, so when the prober
+// is a chain, candidates are ranked by the position of their method in the chain first.
+func getLowestRTTServers(ctx context.Context, candidates []api.Server, count, samples int, prober api.Prober) ([]api.Server, error) {
+	if len(candidates) == 0 {
+		return []api.Server{}, ErrNoCandidatesToRank
+	}
+
+	results := make([]Candidate, len(candidates))
+	errs := make([]error, len(candidates))
+
+	var wg sync.WaitGroup
+	for i, c := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = Candidate{Server: c}
+			results[i].RTT, results[i].Method, errs[i] = medianRTT(ctx, c, samples, prober)
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return []api.Server{}, err
+	}
+
+	// Keep the reachable servers for sorting.
+	s := make([]Candidate, 0, len(candidates))
+	methods := map[string]bool{}
+	for i, c := range results {
+		if errs[i] != nil {
+			logger.FromContext(ctx).Info("excluding unreachable server", logger.KeyServer, c.Server.Name, "city", c.Server.Location.City, "country", c.Server.Location.Country, "error", errs[i])
+			continue
+		}
+
+		s = append(s, c)
+		methods[c.Method] = true
+		logger.FromContext(ctx).Info("probed server", logger.KeyServer, c.Server.Name, "city", c.Server.Location.City, "country", c.Server.Location.Country, "method", c.Method, "median_rtt", c.RTT.Round(time.Millisecond))
+	}
+
+	if len(s) == 0 {
+		return []api.Server{}, ErrNoReachableCandidates
+	} else if len(s) < count {
+		logger.FromContext(ctx).Info("fewer reachable candidates than requested", "reachable", len(s), "count", count)
+		count = len(s)
+	}
+
+	rank := func(method string) int { return 0 }
+	ranker, ok := prober.(api.MethodRanker)
+	if ok {
+		rank = ranker.Rank
+	}
+
+	if len(methods) > 1 && ok {
+		logger.FromContext(ctx).Warn("the candidates were probed with different methods; servers probed with the methods the prober prefers are ranked first")
+	} else if len(methods) > 1 {
+		logger.FromContext(ctx).Warn("the candidates were probed with different methods and the prober does not rank them; their round-trip times are compared as they are")
+	}
+
+	// Sort by method, then RTT (ascending).
+	sort.SliceStable(s, func(i, j int) bool {
+		if ri, rj := rank(s[i].Method), rank(s[j].Method); ri != rj {
+			return ri < rj
+		}
+
+		return s[i].RTT < s[j].RTT
+	})
+
+	// Hold only the top N lowest RTT servers.
+	servers := make([]api.Server, count)
+	for i := 0; i < count; i++ {
+		servers[i] = s[i].Server
+	}
+
+	return servers, nil
+}
+
+// medianRTT probes the server the number of samples times and returns the median of the replies
+// with the method that measured them. The probe may take the probe timeout on top of a second for
+// each sample before the server is considered unreachable.
+func medianRTT(ctx context.Context, server api.Server, samples int, prober api.Prober) (time.Duration, string, error) {
+	timeout := time.Duration(samples)*probeSampleTime + probeTimeout
+
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	set, err := prober.Probe(probeCtx, server, samples)
+	if err != nil {
+		if ctx.Err() == nil && probeCtx.Err() != nil {
+			return 0, "", fmt.Errorf("%w: no reply within %s", ErrCandidateUnreachable, timeout)
+		}
+
+		return 0, "", fmt.Errorf("%w: %w", ErrCandidateUnreachable, err)
+	}
+
+	if set.Lost > 0 {
+		logger.FromContext(ctx).Debug("probes were lost", logger.KeyServer, server.Name, "method", set.Method, "lost", set.Lost, "sent", set.Sent())
+	}
+
+	return set.Median(), set.Method, nil
+}
+
+// getHighestThroughputServers runs a short download against each candidate and returns the count
+// servers with the highest rate. Candidates that fail the download are skipped, and the error of the
+// last one is returned when they all fail. The downloads run one at a time so that they do not
+// compete for the link.
+func getHighestThroughputServers(ctx context.Context, candidates []api.Server, count int, duration time.Duration) ([]api.Server, error) {
+	type ranked struct {
+		server api.Server
+		bps    float64
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrNoCandidatesToRank
+	}
+
+	var results []ranked
+	var lastErr error
+	for _, s := range candidates {
+		t, err := s.PreTest(ctx, duration)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			lastErr = err
+			logger.FromContext(ctx).Warn("throughput pre-test failed", logger.KeyServer, s.Name, "error", err)
+			continue
+		}
+
+		logger.FromContext(ctx).Info("pre-tested server", logger.KeyServer, s.Name, "city", s.Location.City, "country", s.Location.Country, "rate", api.BitRate(t.BitsPerSecond(), false))
+		results = append(results, ranked{server: s, bps: t.BitsPerSecond()})
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%w: %w", ErrNoPreTestedCandidates, lastErr)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].bps > results[j].bps
+	})
+
+	servers := make([]api.Server, 0, count)
+	for i := 0; i < len(results) && i < count; i++ {
+		servers = append(servers, results[i].server)
+	}
+
+	return servers, nil
+}
+
+func serverHost(s api.Server) string {
+	u, err := s.GetURL()
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool { return strings.EqualFold(strings.TrimSpace(v), s) })
+}
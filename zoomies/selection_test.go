@@ -0,0 +1,357 @@
+package zoomies
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"gotest.tools/v3/assert"
+)
+
+func selectionTestServers() []api.Server {
+	servers := []api.Server{
+		{Name: "lhr1", URL: "https://lhr1.example.net/speedtest"},
+		{Name: "lhr2", URL: "https://lhr2.example.net/speedtest"},
+		{Name: "ams1", URL: "https://ams1.example.net/speedtest"},
+	}
+	servers[0].Location.City, servers[0].Location.Country = "London", "GB"
+	servers[1].Location.City, servers[1].Location.Country = "London", "GB"
+	servers[2].Location.City, servers[2].Location.Country = "Amsterdam", "NL"
+
+	return servers
+}
+
+func TestSelectionFilter(t *testing.T) {
+	testCases := []struct {
+		name      string
+		selection Selection
+		expected  []string
+		err       error
+	}{
+		{name: "No filters keep every server", expected: []string{"lhr1", "lhr2", "ams1"}},
+		{name: "Pin by name", selection: Selection{Pin: "lhr2"}, expected: []string{"lhr2"}},
+		{name: "Pin by host", selection: Selection{Pin: "ams1.example.net"}, expected: []string{"ams1"}},
+		{name: "Pin by index", selection: Selection{Pin: "3"}, expected: []string{"ams1"}},
+		{name: "Pin takes precedence over filters", selection: Selection{Pin: "ams1", Countries: []string{"GB"}}, expected: []string{"ams1"}},
+		{name: "Pin index out of range", selection: Selection{Pin: "4"}, err: ErrPinnedServerNotFound},
+		{name: "Pin unknown name", selection: Selection{Pin: "fra1"}, err: ErrPinnedServerNotFound},
+		{name: "Filter by country", selection: Selection{Countries: []string{"gb"}}, expected: []string{"lhr1", "lhr2"}},
+		{name: "Filter by city", selection: Selection{Cities: []string{"Amsterdam"}}, expected: []string{"ams1"}},
+		{name: "Exclude by name and host", selection: Selection{Exclude: []string{"lhr1", "ams1.example.net"}}, expected: []string{"lhr2"}},
+		{name: "Nothing left", selection: Selection{Countries: []string{"US"}}, err: ErrNoServersMatch},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.selection.filter(context.Background(), selectionTestServers())
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			assert.NilError(t, err)
+
+			names := make([]string, len(got))
+			for i, s := range got {
+				names[i] = s.Name
+			}
+
+			assert.DeepEqual(t, names, tt.expected)
+		})
+	}
+}
+
+func TestSelectionValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		selection Selection
+		err       error
+	}{
+		{name: "Defaults are valid", selection: DefaultSelection()},
+		{name: "Unknown rank", selection: Selection{Rank: "fastest", RankSamples: 1}, err: ErrUnknownRankStrategy},
+		{name: "Too many samples", selection: Selection{Rank: RankRTT, RankSamples: 11}, err: ErrRankSamplesOutOfBounds},
+		{name: "No samples", selection: Selection{Rank: RankRTT, RankSamples: 0}, err: ErrRankSamplesOutOfBounds},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.selection.validate()
+			if tt.err == nil {
+				assert.NilError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestGetHighestThroughputServers(t *testing.T) {
+	newServer := func(name string, size int) (api.Server, *httptest.Server) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(10 * time.Millisecond)
+			w.Write(make([]byte, size))
+		}))
+
+		return api.Server{Name: name, URL: srv.URL}, srv
+	}
+
+	slow, slowSrv := newServer("slow", 1024)
+	defer slowSrv.Close()
+
+	fast, fastSrv := newServer("fast", 64*1024)
+	defer fastSrv.Close()
+
+	down, downSrv := newServer("down", 0)
+	downSrv.Close()
+
+	got, err := getHighestThroughputServers(context.Background(), []api.Server{slow, down, fast}, 2, 100*time.Millisecond)
+
+	assert.NilError(t, err)
+	assert.Equal(t, len(got), 2)
+	assert.Equal(t, got[0].Name, "fast")
+	assert.Equal(t, got[1].Name, "slow")
+
+	_, err = getHighestThroughputServers(context.Background(), []api.Server{down}, 1, 100*time.Millisecond)
+	assert.ErrorIs(t, err, ErrNoPreTestedCandidates)
+	assert.ErrorContains(t, err, "connection refused")
+}
+
+// mockRTTs are the round-trip times reported by mockProbeFunc. Servers not listed never reply.
+var mockRTTs = map[string]time.Duration{
+	"server1": 20 * time.Millisecond,
+	"server2": 40 * time.Millisecond,
+	"server3": 60 * time.Millisecond,
+}
+
+func mockProbeFunc(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+	rtt, ok := mockRTTs[server.Name]
+	if !ok {
+		return nil, api.ErrNoReply
+	}
+
+	samples := &api.Samples{}
+	for i := 0; i < count; i++ {
+		samples.RTTs = append(samples.RTTs, rtt)
+	}
+
+	return samples, nil
+}
+
+func TestGetLowestRTTServers(t *testing.T) {
+	testCases := []struct {
+		name       string
+		candidates []api.Server
+		count      int
+		probeFunc  func(ctx context.Context, server api.Server, count int) (*api.Samples, error)
+		expected   []string
+		err        error
+	}{
+		{
+			name: "Top 2 servers with the lowest rtt",
+			candidates: []api.Server{
+				{Name: "server3"},
+				{Name: "server1"},
+				{Name: "server2"},
+			},
+			count:     2,
+			probeFunc: mockProbeFunc,
+			expected:  []string{"server1", "server2"},
+			err:       nil,
+		},
+		{
+			name: "Request more servers than available",
+			candidates: []api.Server{
+				{Name: "server1"},
+				{Name: "server2"},
+			},
+			count:     4,
+			probeFunc: mockProbeFunc,
+			expected:  []string{"server1", "server2"},
+			err:       nil,
+		},
+		{
+			name: "Unreachable servers are excluded",
+			candidates: []api.Server{
+				{Name: "unreachable"},
+				{Name: "server2"},
+			},
+			count:     2,
+			probeFunc: mockProbeFunc,
+			expected:  []string{"server2"},
+			err:       nil,
+		},
+		{
+			name: "Hung probes are excluded",
+			candidates: []api.Server{
+				{Name: "server1"},
+				{Name: "hung"},
+			},
+			count: 2,
+			probeFunc: func(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+				if server.Name == "hung" {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				return mockProbeFunc(ctx, server, count)
+			},
+			expected: []string{"server1"},
+			err:      nil,
+		},
+		{
+			name: "No server replied",
+			candidates: []api.Server{
+				{Name: "unreachable"},
+			},
+			count:     1,
+			probeFunc: mockProbeFunc,
+			expected:  []string{},
+			err:       ErrNoReachableCandidates,
+		},
+		{
+			name:       "Empty list of servers passed",
+			candidates: []api.Server{},
+			count:      4,
+			probeFunc:  mockProbeFunc,
+			expected:   []string{},
+			err:        ErrNoCandidatesToRank,
+		},
+	}
+
+	probeSampleTime, probeTimeout = 10*time.Millisecond, 50*time.Millisecond
+	t.Cleanup(func() { probeSampleTime, probeTimeout = time.Second, ProbeTimeout })
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getLowestRTTServers(context.Background(), tt.candidates, tt.count, 3, api.NewProber("mock", tt.probeFunc))
+			if err != nil {
+				assert.Error(t, err, tt.err.Error())
+			}
+
+			names := make([]string, len(got))
+			for i, server := range got {
+				names[i] = server.Name
+			}
+
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("got %v, want %v", names, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMedianRTT(t *testing.T) {
+	testCases := []struct {
+		name     string
+		samples  *api.Samples
+		expected time.Duration
+		err      error
+	}{
+		{name: "Median of the replies", samples: &api.Samples{RTTs: []time.Duration{90, 10, 20}}, expected: 20},
+		{name: "Lost samples are skipped", samples: &api.Samples{RTTs: []time.Duration{30}, Lost: 2}, expected: 30},
+		{name: "Every sample lost", err: api.ErrNoReply},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			probe := api.NewProber("mock", func(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+				assert.Equal(t, count, 3)
+				if tt.samples == nil {
+					return nil, api.ErrNoReply
+				}
+				return tt.samples, nil
+			})
+
+			rtt, method, err := medianRTT(context.Background(), api.Server{Name: "server1"}, 3, probe)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, ErrCandidateUnreachable)
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, rtt, tt.expected)
+			assert.Equal(t, method, "mock")
+		})
+	}
+}
+
+// rankingProber measures server3 with a precise method and the others with a coarse one, and
+// prefers the precise method.
+type rankingProber struct{}
+
+func (rankingProber) Method() string { return "custom" }
+
+func (rankingProber) Probe(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+	samples, err := mockProbeFunc(ctx, server, count)
+	if err != nil {
+		return nil, err
+	}
+
+	samples.Method = "coarse"
+	if server.Name == "server3" {
+		samples.Method = "precise"
+	}
+
+	return samples, nil
+}
+
+func (rankingProber) Rank(method string) int {
+	if method == "precise" {
+		return 0
+	}
+
+	return 1
+}
+
+func TestGetLowestRTTServersRanksByMethodRanker(t *testing.T) {
+	got, err := getLowestRTTServers(context.Background(), []api.Server{{Name: "server1"}, {Name: "server2"}, {Name: "server3"}}, 3, 1, rankingProber{})
+
+	assert.NilError(t, err)
+	assert.Equal(t, got[0].Name, "server3")
+	assert.Equal(t, got[1].Name, "server1")
+	assert.Equal(t, got[2].Name, "server2")
+}
+
+func TestGetLowestRTTServersRanksByMethod(t *testing.T) {
+	denied := &os.SyscallError{Syscall: "socket", Err: syscall.EACCES}
+
+	// ICMP only reaches server3, the others fall back to TCP with lower round-trip times.
+	icmp := api.NewProber(api.ProbeICMP, func(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+		if server.Name == "server3" {
+			return mockProbeFunc(ctx, server, count)
+		}
+		return nil, api.ErrNoReply
+	})
+	tcp := api.NewProber(api.ProbeTCP, mockProbeFunc)
+
+	chain := api.NewProbeChain(icmp, tcp)
+	got, err := getLowestRTTServers(context.Background(), []api.Server{{Name: "server1"}, {Name: "server2"}, {Name: "server3"}}, 3, 1, chain)
+
+	assert.NilError(t, err)
+	assert.Equal(t, got[0].Name, "server3")
+	assert.Equal(t, got[1].Name, "server1")
+
+	// A denied method is skipped for every later probe.
+	var calls atomic.Int64
+	chain = api.NewProbeChain(
+		api.NewProber(api.ProbeICMP, func(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+			calls.Add(1)
+			return nil, denied
+		}),
+		tcp,
+	)
+	for i := 0; i < 3; i++ {
+		_, err = getLowestRTTServers(context.Background(), []api.Server{{Name: "server1"}, {Name: "server2"}}, 2, 3, chain)
+		assert.NilError(t, err)
+	}
+
+	assert.Assert(t, calls.Load() <= 2)
+}
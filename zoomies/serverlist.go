@@ -0,0 +1,274 @@
+package zoomies
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/cache"
+	"github.com/primlock/zoomies/internal/logger"
+	"github.com/primlock/zoomies/internal/retry"
+)
+
+// ServerList is the list of test servers handed out by fast.com, with the details of the client it
+// was handed out to.
+type ServerList struct {
+	Client  api.Client   `json:"client"`
+	Targets []api.Server `json:"targets"`
+
+	// The response the list was decoded from.
+	raw []byte
+}
+
+var (
+	ErrEmptyServersFile      = errors.New("the servers file lists no servers")
+	ErrInvalidServerURL      = errors.New("server url must be an absolute http or https url")
+	ErrRecordWithServersFile = errors.New("--record saves the response from fast.com and cannot be combined with --servers-file")
+	ErrServerListStatus      = errors.New("unexpected status code from the server list")
+)
+
+// loadServerList returns the servers to test against, read from the servers file when one is given
+// and discovered through fast.com otherwise. A discovered list is saved to the record file when
+// one is given so that it can be replayed with --servers-file.
+func loadServerList(ctx context.Context, opts *Options, rec *phaseRecorder) (*ServerList, error) {
+	if opts.ServersFile != "" {
+		var remote *ServerList
+		err := rec.track(ctx, PhaseServerList, ServerListTimeout, func(ctx context.Context) error {
+			var err error
+			remote, err = readServersFile(opts.ServersFile)
+			return err
+		})
+
+		return remote, err
+	}
+
+	remote, err := getRemoteServerList(ctx, opts, rec)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Record != "" {
+		if err := os.WriteFile(opts.Record, remote.raw, 0o644); err != nil {
+			return nil, fmt.Errorf("error recording the server list: %w", err)
+		}
+
+		logger.FromContext(ctx).Info("recorded the server list", "file", opts.Record)
+	}
+
+	return remote, nil
+}
+
+// readServersFile reads a servers file, which holds either a response recorded from fast.com or a
+// list of server urls as a JSON array or one per line.
+func readServersFile(path string) (*ServerList, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading servers file: %w", err)
+	}
+
+	remote, err := parseServersFile(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return remote, nil
+}
+
+func parseServersFile(b []byte) (*ServerList, error) {
+	b = bytes.TrimSpace(b)
+
+	var urls []string
+	switch {
+	case bytes.HasPrefix(b, []byte("{")):
+		remote, err := decodeServerList(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(remote.Targets) == 0 {
+			return nil, ErrEmptyServersFile
+		}
+
+		return remote, nil
+	case bytes.HasPrefix(b, []byte("[")):
+		if err := json.Unmarshal(b, &urls); err != nil {
+			return nil, err
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				urls = append(urls, line)
+			}
+		}
+	}
+
+	if len(urls) == 0 {
+		return nil, ErrEmptyServersFile
+	}
+
+	remote := &ServerList{raw: b}
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidServerURL, raw)
+		}
+
+		remote.Targets = append(remote.Targets, api.Server{Name: u.Hostname(), URL: raw})
+	}
+
+	return remote, nil
+}
+
+// The endpoint and functions that reach fast.com, replaced in tests.
+var (
+	serverListURL   = api.FastSpeedTestServerURL
+	discoverToken   = api.GetAPIEndpointToken
+	fetchServerList = requestServerList
+)
+
+// getRemoteServerList gets a list of servers from a remote URL. Unless a token is given, the token
+// and the server list are read from the cache while they are fresh, and a token rejected by
+// fast.com is replaced by a new one. Failed requests are retried with backoff. The time spent on
+// each request is recorded in 'rec' when it is not nil.
+func getRemoteServerList(ctx context.Context, opts *Options, rec *phaseRecorder) (*ServerList, error) {
+	policy := retry.NewPolicy(opts.Retries)
+
+	if opts.Token != "" {
+		return trackServerList(ctx, opts.Token, policy, rec)
+	}
+
+	c := cache.New(opts.CacheFile)
+
+	if body, ok := c.ServerList(); ok {
+		if remote, err := decodeServerList(body); err == nil {
+			logger.FromContext(ctx).Info("using the cached server list", "file", c.Path)
+			return remote, nil
+		}
+	}
+
+	token, cached := c.Token()
+	if cached {
+		logger.FromContext(ctx).Info("using the cached api endpoint token", "file", c.Path)
+	} else {
+		var err error
+		if token, err = trackTokenDiscovery(ctx, c, opts, rec); err != nil {
+			return nil, err
+		}
+	}
+
+	// A rejected token is replaced once when it came from the cache, since it may have expired
+	// before its time to live, and otherwise only when failed requests are retried.
+	remote, err := trackServerList(ctx, token, policy, rec)
+	if errors.Is(err, ErrUnknownAppToken) && (cached || opts.Retries > 0) {
+		logger.FromContext(ctx).Warn("the api endpoint token was rejected; getting a new one")
+		rec.retried()
+
+		if err := c.Invalidate(); err != nil {
+			logger.FromContext(ctx).Warn("failed to invalidate the cache", "error", err)
+		}
+
+		if token, err = trackTokenDiscovery(ctx, c, opts, rec); err != nil {
+			return nil, err
+		}
+
+		remote, err = trackServerList(ctx, token, policy, rec)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.SetServerList(remote.raw, opts.ServerListTTL); err != nil {
+		logger.FromContext(ctx).Warn("failed to cache the server list", "error", err)
+	}
+
+	return remote, nil
+}
+
+// trackTokenDiscovery scrapes a new token from fast.com and caches it.
+func trackTokenDiscovery(ctx context.Context, c *cache.Cache, opts *Options, rec *phaseRecorder) (string, error) {
+	logger.FromContext(ctx).Info("no token was given; getting an api endpoint token")
+
+	var token string
+	err := rec.trackRetries(ctx, PhaseTokenDiscovery, TokenDiscoveryTimeout, retry.NewPolicy(opts.Retries), func(ctx context.Context) error {
+		var err error
+		token, err = discoverToken(ctx)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.SetToken(token, opts.TokenTTL); err != nil {
+		logger.FromContext(ctx).Warn("failed to cache the api endpoint token", "error", err)
+	}
+
+	return token, nil
+}
+
+// trackServerList fetches the server list with the token. A rejected token is not retried since it
+// has to be replaced first.
+func trackServerList(ctx context.Context, token string, policy retry.Policy, rec *phaseRecorder) (*ServerList, error) {
+	var remote *ServerList
+	err := rec.trackRetries(ctx, PhaseServerList, ServerListTimeout, policy, func(ctx context.Context) error {
+		body, err := fetchServerList(ctx, token)
+		if errors.Is(err, ErrUnknownAppToken) {
+			return retry.Permanent(err)
+		} else if err != nil {
+			return err
+		}
+
+		remote, err = decodeServerList(body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return remote, nil
+}
+
+// requestServerList queries the remote for the JSON list of the nearest servers. Client errors
+// other than a timeout or rate limit are not retried since the same request fails again.
+func requestServerList(ctx context.Context, token string) ([]byte, error) {
+	resp, err := api.Get(ctx, fmt.Sprintf("%s?token=%s&https=true", serverListURL, token))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		logger.FromContext(ctx).Debug("the server list request was rejected", "url", serverListURL, "status", resp.StatusCode)
+		return nil, ErrUnknownAppToken
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return nil, fmt.Errorf("%w %d", ErrServerListStatus, resp.StatusCode)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return nil, retry.Permanent(fmt.Errorf("%w %d", ErrServerListStatus, resp.StatusCode))
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, fmt.Errorf("%w %d", ErrServerListStatus, resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// decodeServerList converts the remote response into a JSON object, keeping the response so it can
+// be cached.
+func decodeServerList(body []byte) (*ServerList, error) {
+	remote := &ServerList{raw: body}
+	if err := json.Unmarshal(body, remote); err != nil {
+		return nil, err
+	}
+
+	return remote, nil
+}
@@ -0,0 +1,290 @@
+package zoomies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/cache"
+	"github.com/primlock/zoomies/internal/retry"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseServersFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []string
+		err      error
+	}{
+		{
+			name:     "Recorded response",
+			input:    `{"client":{"ip":"192.0.2.1"},"targets":[{"name":"oca1","url":"https://oca1.example/speedtest"}]}`,
+			expected: []string{"oca1"},
+		},
+		{
+			name:     "JSON array of urls",
+			input:    `["https://a.example/speedtest", "http://b.example:8080/speedtest"]`,
+			expected: []string{"a.example", "b.example"},
+		},
+		{
+			name:     "One url per line",
+			input:    "# lab servers\nhttps://a.example/speedtest\n\nhttps://b.example/speedtest\n",
+			expected: []string{"a.example", "b.example"},
+		},
+		{name: "Empty file", input: "\n# nothing here\n", err: ErrEmptyServersFile},
+		{name: "Response without targets", input: `{"targets":[]}`, err: ErrEmptyServersFile},
+		{name: "Url without a scheme", input: "a.example/speedtest", err: ErrInvalidServerURL},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseServersFile([]byte(tt.input))
+
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			assert.NilError(t, err)
+
+			var names []string
+			for _, s := range got.Targets {
+				names = append(names, s.Name)
+			}
+			assert.DeepEqual(t, names, tt.expected)
+		})
+	}
+}
+
+func TestRecordAndReplayServerList(t *testing.T) {
+	const list = `{"client":{"ip":"192.0.2.1"},"targets":[{"name":"oca1","url":"https://oca1.example/speedtest"}]}`
+
+	fetchServerList = func(ctx context.Context, token string) ([]byte, error) {
+		return []byte(list), nil
+	}
+	t.Cleanup(func() { fetchServerList = requestServerList })
+
+	record := filepath.Join(t.TempDir(), "servers.json")
+
+	opts := DefaultOptions()
+	opts.Token = "token"
+	opts.Record = record
+
+	_, err := loadServerList(context.Background(), &opts, nil)
+	assert.NilError(t, err)
+
+	b, err := os.ReadFile(record)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), list)
+
+	fetchServerList = func(ctx context.Context, token string) ([]byte, error) {
+		t.Fatal("the server list was fetched while replaying")
+		return nil, nil
+	}
+
+	opts = DefaultOptions()
+	opts.ServersFile = record
+
+	got, err := loadServerList(context.Background(), &opts, nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, got.Targets, []api.Server{{Name: "oca1", URL: "https://oca1.example/speedtest"}})
+	assert.Equal(t, got.Client.IP, "192.0.2.1")
+}
+
+func TestGetRemoteServerListCache(t *testing.T) {
+	const list = `{"client":{"isp":"Example"},"targets":[{"name":"server1"}]}`
+
+	testCases := []struct {
+		name          string
+		token         string
+		cachedToken   string
+		cachedList    bool
+		validToken    string
+		discoveries   int
+		fetches       int
+		expectedToken string
+	}{
+		{name: "Token discovered and cached", validToken: "fresh", discoveries: 1, fetches: 1, expectedToken: "fresh"},
+		{name: "Cached token reused", cachedToken: "cached", validToken: "cached", discoveries: 0, fetches: 1, expectedToken: "cached"},
+		{name: "Rejected cached token rediscovered", cachedToken: "stale", validToken: "fresh", discoveries: 1, fetches: 2, expectedToken: "fresh"},
+		{name: "Cached server list reused", cachedToken: "cached", cachedList: true, validToken: "cached", discoveries: 0, fetches: 0, expectedToken: "cached"},
+		{name: "Provided token skips the cache", token: "mine", cachedToken: "cached", cachedList: true, validToken: "mine", discoveries: 0, fetches: 1, expectedToken: "cached"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Token = tt.token
+			opts.CacheFile = filepath.Join(t.TempDir(), "cache.json")
+			opts.ServerListTTL = time.Minute
+
+			c := cache.New(opts.CacheFile)
+			if tt.cachedToken != "" {
+				assert.NilError(t, c.SetToken(tt.cachedToken, time.Hour))
+			}
+			if tt.cachedList {
+				assert.NilError(t, c.SetServerList([]byte(list), time.Hour))
+			}
+
+			var discoveries, fetches int
+			discoverToken = func(ctx context.Context) (string, error) {
+				discoveries++
+				return tt.validToken, nil
+			}
+			fetchServerList = func(ctx context.Context, token string) ([]byte, error) {
+				fetches++
+				if token != tt.validToken {
+					return nil, ErrUnknownAppToken
+				}
+				return []byte(list), nil
+			}
+			t.Cleanup(func() {
+				discoverToken = api.GetAPIEndpointToken
+				fetchServerList = requestServerList
+			})
+
+			remote, err := getRemoteServerList(context.Background(), &opts, nil)
+			assert.NilError(t, err)
+
+			assert.Equal(t, remote.Targets[0].Name, "server1")
+			assert.Equal(t, discoveries, tt.discoveries)
+			assert.Equal(t, fetches, tt.fetches)
+
+			token, _ := c.Token()
+			assert.Equal(t, token, tt.expectedToken)
+
+			_, ok := c.ServerList()
+			assert.Assert(t, ok)
+		})
+	}
+}
+
+func TestGetRemoteServerListRetries(t *testing.T) {
+	const list = `{"client":{"isp":"Example"},"targets":[{"name":"server1"}]}`
+	errFlaky := errors.New("connection reset")
+
+	testCases := []struct {
+		name        string
+		retries     int
+		cachedToken string
+		failures    int
+		rejected    int
+		discoveries int
+		retryCount  int
+		expected    error
+	}{
+		{name: "Transient failure retried", retries: 3, failures: 1, discoveries: 1, retryCount: 1},
+		{name: "Rejected token replaced", retries: 3, rejected: 1, discoveries: 2, retryCount: 1},
+		{name: "Retries disabled", retries: 0, failures: 1, discoveries: 1, expected: errFlaky},
+		{name: "Rejected token without retries", retries: 0, rejected: 1, discoveries: 1, expected: ErrUnknownAppToken},
+		{name: "Rejected cached token without retries", retries: 0, cachedToken: "stale", rejected: 1, discoveries: 1, retryCount: 1},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.CacheFile = filepath.Join(t.TempDir(), "cache.json")
+			opts.Retries = tt.retries
+
+			c := cache.New(opts.CacheFile)
+			if tt.cachedToken != "" {
+				assert.NilError(t, c.SetToken(tt.cachedToken, time.Hour))
+			}
+
+			var discoveries, fetches int
+			discoverToken = func(ctx context.Context) (string, error) {
+				discoveries++
+				return fmt.Sprintf("token%d", discoveries), nil
+			}
+			fetchServerList = func(ctx context.Context, token string) ([]byte, error) {
+				fetches++
+				if fetches <= tt.failures {
+					return nil, errFlaky
+				}
+				if fetches <= tt.failures+tt.rejected {
+					return nil, ErrUnknownAppToken
+				}
+				return []byte(list), nil
+			}
+			t.Cleanup(func() {
+				discoverToken = api.GetAPIEndpointToken
+				fetchServerList = requestServerList
+			})
+
+			rec := &phaseRecorder{}
+			_, err := getRemoteServerList(context.Background(), &opts, rec)
+
+			if tt.expected != nil {
+				assert.ErrorIs(t, err, tt.expected)
+			} else {
+				assert.NilError(t, err)
+			}
+
+			assert.Equal(t, discoveries, tt.discoveries)
+			assert.Equal(t, rec.retryCount(), tt.retryCount)
+
+			if tt.expected == nil {
+				token, _ := c.Token()
+				assert.Equal(t, token, fmt.Sprintf("token%d", discoveries))
+			}
+		})
+	}
+}
+
+func TestRequestServerListStatus(t *testing.T) {
+	const list = `{"client":{"isp":"Example"},"targets":[{"name":"server1"}]}`
+
+	testCases := []struct {
+		name     string
+		statuses []int
+		requests int
+		expected string
+	}{
+		{name: "Server error retried", statuses: []int{http.StatusServiceUnavailable, http.StatusOK}, requests: 2},
+		{name: "Rate limit retried", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, requests: 2},
+		{name: "Server error on every attempt", statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}, requests: 2, expected: "unexpected status code from the server list 503"},
+		{name: "Client error not retried", statuses: []int{http.StatusNotFound, http.StatusOK}, requests: 1, expected: "unexpected status code from the server list 404"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[requests]
+				requests++
+
+				if status != http.StatusOK {
+					http.Error(w, "<html>unavailable</html>", status)
+					return
+				}
+
+				w.Write([]byte(list))
+			}))
+			defer srv.Close()
+
+			serverListURL = srv.URL
+			t.Cleanup(func() { serverListURL = api.FastSpeedTestServerURL })
+
+			policy := retry.Policy{Attempts: 2, Initial: time.Millisecond, Max: time.Millisecond}
+			remote, err := trackServerList(context.Background(), "token", policy, nil)
+
+			assert.Equal(t, requests, tt.requests)
+			if tt.expected != "" {
+				assert.ErrorIs(t, err, ErrServerListStatus)
+				assert.Error(t, err, tt.expected)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, remote.Targets[0].Name, "server1")
+		})
+	}
+}
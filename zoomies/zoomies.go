@@ -0,0 +1,549 @@
+// Package zoomies runs network speed tests against the servers of fast.com. It discovers the test
+// servers, ranks them and measures the latency, download and upload rates of the best one without
+// writing anything to the terminal, so that it can be embedded in other programs:
+//
+//	report, err := zoomies.Run(ctx, zoomies.DefaultOptions())
+package zoomies
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/cache"
+	"github.com/primlock/zoomies/internal/logger"
+	"github.com/primlock/zoomies/internal/retry"
+)
+
+var (
+	ErrUnknownAppToken        = errors.New("invalid token passed as a parameter")
+	ErrDurationOutOfBounds    = errors.New("duration must be in the range 3-30 inclusive")
+	ErrPingCountOutOfBounds   = errors.New("ping must be in the range 1-5 inclusive")
+	ErrNoCandidatesToRank     = errors.New("the candidates object supplied was nil")
+	ErrNoReachableCandidates  = errors.New("none of the candidate servers replied to a probe")
+	ErrNoPreTestedCandidates  = errors.New("none of the candidate servers completed a throughput pre-test")
+	ErrCandidateUnreachable   = errors.New("no probe was answered")
+	ErrTimeoutOutOfBounds     = errors.New("timeout must be at least 1 second")
+	ErrTimeoutTooShort        = errors.New("timeout leaves too little time for the transfers")
+	ErrConnectionsOutOfBounds = errors.New("connections must be in the range 1-32 inclusive")
+	ErrChunkSizeOutOfBounds   = errors.New("chunk size must be in the range 1KiB-1GiB")
+	ErrUploadSizeOutOfBounds  = errors.New("upload size must be in the range 1KiB-1GiB")
+	ErrServerCountOutOfBounds = errors.New("servers must be in the range 1-20 inclusive")
+	ErrRetriesOutOfBounds     = errors.New("retries must be in the range 0-10 inclusive")
+)
+
+const (
+	DefaultTimeout       = 90 * time.Second
+	DefaultDuration      = 15 * time.Second
+	DefaultPings         = 3
+	DefaultConnections   = 3
+	DefaultChunkSize     = 25 * 1024 * 1024
+	DefaultUploadSize    = 25 * 1024 * 1024
+	DefaultServerCount   = 5
+	DefaultTokenTTL      = 24 * time.Hour
+	DefaultServerListTTL = 0
+	MinDuration          = 3 * time.Second
+	MaxDuration          = 30 * time.Second
+	MaxPings             = 5
+	MaxConnections       = 32
+	MaxServerCount       = 20
+	MaxRetries           = 10
+	MinTransferSize      = 1024
+	MaxTransferSize      = 1024 * 1024 * 1024
+
+	// The time the timeout must leave on top of the transfers for the discovery, selection and
+	// latency phases.
+	TimeoutSlack = 30 * time.Second
+
+	// How often the round-trip time is measured during a transfer when loaded latency is measured.
+	LoadedLatencyInterval = 500 * time.Millisecond
+)
+
+// Options configures a run. Start from DefaultOptions, since the zero value is not a valid run.
+type Options struct {
+	// The fast.com api token. A token is scraped from fast.com when it is empty.
+	Token string
+
+	// The file the api token and server list are cached in, and how long each is kept. An empty
+	// file disables the cache.
+	CacheFile     string
+	TokenTTL      time.Duration
+	ServerListTTL time.Duration
+
+	// A file listing the servers to test against instead of discovering them through fast.com.
+	ServersFile string
+
+	// A file the server list discovered through fast.com is saved to for replay.
+	Record string
+
+	// The number of times a failed request or expired transfer is retried.
+	Retries int
+
+	// The time the whole run may take.
+	Timeout time.Duration
+
+	// The time the download and upload tests run for.
+	Duration time.Duration
+
+	// The number of pings sent to the server in the latency test.
+	Pings int
+
+	// The number of concurrent requests made in the download and upload tests.
+	Connections int
+
+	// The number of bytes requested by each download request and sent by each upload request.
+	ChunkSize  int64
+	UploadSize int
+
+	// The number of ranked servers kept as candidates.
+	Servers int
+
+	// Skip the download or upload test.
+	NoDownload bool
+	NoUpload   bool
+
+	// Measure the round-trip time with TCP connects while the download and upload tests run.
+	LoadedLatency bool
+
+	// Which of the discovered servers are tested and how they are ranked.
+	Selection Selection
+
+	// Measures the round-trip times used to rank the servers and in the latency test. The default
+	// probe chain is used when it is nil.
+	Prober api.Prober
+
+	// Told about the progress of the run when it is not nil.
+	Observer Observer
+
+	// Skips phases, aborts the run or changes the connections of the transfers while the run goes
+	// on when it is not nil.
+	Control *Control
+
+	// Receives the records of the run with the request id of the run, the phase and the server
+	// under test as fields. Nothing is logged when it is nil.
+	Logger *slog.Logger
+}
+
+// DefaultOptions returns the options of a run with the default settings, caching the api token in
+// the user's cache directory.
+func DefaultOptions() Options {
+	return Options{
+		CacheFile:     cache.DefaultPath(),
+		TokenTTL:      DefaultTokenTTL,
+		ServerListTTL: DefaultServerListTTL,
+		Retries:       retry.DefaultRetries,
+		Timeout:       DefaultTimeout,
+		Duration:      DefaultDuration,
+		Pings:         DefaultPings,
+		Connections:   DefaultConnections,
+		ChunkSize:     DefaultChunkSize,
+		UploadSize:    DefaultUploadSize,
+		Servers:       DefaultServerCount,
+		Selection:     DefaultSelection(),
+	}
+}
+
+// Validate checks that the options are within their bounds.
+func (o *Options) Validate() error {
+	if o.Duration < MinDuration || o.Duration > MaxDuration {
+		return ErrDurationOutOfBounds
+	}
+
+	if o.Pings < 1 || o.Pings > MaxPings {
+		return ErrPingCountOutOfBounds
+	}
+
+	if o.Timeout < time.Second {
+		return ErrTimeoutOutOfBounds
+	}
+
+	if min := o.minTimeout(); o.Timeout < min {
+		return fmt.Errorf("%w: --timeout must be at least %d seconds with a --duration of %d seconds", ErrTimeoutTooShort, int(min/time.Second), int(o.Duration/time.Second))
+	}
+
+	if o.Connections < 1 || o.Connections > MaxConnections {
+		return ErrConnectionsOutOfBounds
+	}
+
+	if o.ChunkSize < MinTransferSize || o.ChunkSize > MaxTransferSize {
+		return ErrChunkSizeOutOfBounds
+	}
+
+	if o.UploadSize < MinTransferSize || o.UploadSize > MaxTransferSize {
+		return ErrUploadSizeOutOfBounds
+	}
+
+	if o.Servers < 1 || o.Servers > MaxServerCount {
+		return ErrServerCountOutOfBounds
+	}
+
+	if o.Retries < 0 || o.Retries > MaxRetries {
+		return ErrRetriesOutOfBounds
+	}
+
+	if o.Record != "" && o.ServersFile != "" {
+		return ErrRecordWithServersFile
+	}
+
+	return o.Selection.validate()
+}
+
+// minTimeout returns the shortest timeout that leaves time for each transfer of the run to last the
+// duration on top of the other phases.
+func (o *Options) minTimeout() time.Duration {
+	transfers := 0
+	if !o.NoDownload {
+		transfers++
+	}
+	if !o.NoUpload {
+		transfers++
+	}
+
+	return time.Duration(transfers)*o.Duration + TimeoutSlack
+}
+
+// Report holds the result of a run and the problems that did not fail it.
+type Report struct {
+	api.Result
+
+	// Problems such as a failed latency test or requests that failed during a transfer.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Run discovers the testing servers, selects the best and runs the test suite against it. The
+// whole run is bounded by the timeout of the options. When the run is aborted through its control,
+// ErrAborted is returned with the results measured so far, or without a report when no server had
+// been selected yet.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	// The chain remembers the methods that are not permitted on this host between probes.
+	if opts.Prober == nil {
+		opts.Prober = api.DefaultProbeChain()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	opts.Control.start(opts.Connections, abort)
+
+	if opts.Logger != nil {
+		ctx = logger.NewContext(ctx, opts.Logger)
+	}
+	ctx = logger.With(ctx, logger.KeyRequestID, newRequestID())
+
+	rec := newPhaseRecorder(opts.Observer)
+
+	list, err := loadServerList(ctx, &opts, rec)
+	if err != nil {
+		return nil, aborted(&opts, err)
+	}
+
+	candidates, err := opts.Selection.filter(ctx, list.Targets)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []api.Server
+	err = rec.track(ctx, PhaseCandidateProbing, candidateProbingTimeout(&opts, len(candidates)), func(ctx context.Context) error {
+		selected, err := opts.Selection.rank(ctx, candidates, opts.Servers, opts.Prober)
+		if err == nil {
+			servers = selected
+		}
+
+		return err
+	})
+	if err != nil {
+		return nil, aborted(&opts, err)
+	}
+
+	report, err := runTestSuite(ctx, &opts, list.Client, servers, rec)
+	if err != nil && (report == nil || !opts.Control.isAborted()) {
+		return nil, aborted(&opts, err)
+	}
+
+	report.Phases = rec.phases
+	report.Retries = rec.retryCount()
+	report.Warnings = rec.warnings
+
+	return report, aborted(&opts, err)
+}
+
+// newRequestID returns a random id that tells the records of a run apart from those of others.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// aborted returns ErrAborted in place of the error the run failed with when it was aborted.
+func aborted(opts *Options, err error) error {
+	if err != nil && opts.Control.isAborted() {
+		return ErrAborted
+	}
+
+	return err
+}
+
+// Servers returns the servers a run would choose from, read from the servers file of the options
+// or discovered through fast.com, without probing them. It is bounded by the context alone.
+func Servers(ctx context.Context, opts Options) (*ServerList, error) {
+	if opts.Record != "" && opts.ServersFile != "" {
+		return nil, ErrRecordWithServersFile
+	}
+
+	return loadServerList(ctx, &opts, nil)
+}
+
+// runTestSuite runs the latency, download and upload tests against the servers. A failed latency
+// test is reported without ending the run unless the run has run out of time. When the run is
+// aborted, the report of the tests that finished is returned with ErrAborted.
+func runTestSuite(ctx context.Context, opts *Options, client api.Client, servers []api.Server, rec *phaseRecorder) (*Report, error) {
+	var report *Report
+
+	for _, s := range servers {
+		ctx := logger.With(ctx, logger.KeyServer, s.Name)
+		report = &Report{Result: api.Result{Timestamp: time.Now(), Client: client, Server: s}}
+		rec.setTarget(&Target{Client: client, Server: s})
+
+		var latency *api.LatencyResult
+		err := rec.track(ctx, PhaseLatency, phaseTimeout(PhaseLatency, opts), func(ctx context.Context) error {
+			ctx, release := opts.Control.skippable(ctx)
+			defer release()
+
+			start := time.Now()
+			samples, err := opts.Prober.Probe(ctx, s, opts.Pings)
+			if errors.Is(context.Cause(ctx), ErrSkipped) {
+				return ErrSkipped
+			} else if err != nil {
+				return err
+			}
+
+			elapsed := time.Since(start)
+			for _, rtt := range samples.RTTs {
+				rec.sample(PhaseLatency, Sample{Elapsed: elapsed, RTT: rtt, Method: samples.Method})
+			}
+			for i := 0; i < samples.Lost; i++ {
+				rec.sample(PhaseLatency, Sample{Elapsed: elapsed, Method: samples.Method, Lost: true})
+			}
+
+			latency = samples.Latency()
+			return nil
+		})
+		switch {
+		case ctx.Err() != nil:
+			return report, err
+		case errors.Is(err, ErrSkipped):
+			rec.warn(ctx, "latency test was skipped")
+		case err != nil:
+			rec.warn(ctx, fmt.Sprintf("latency test failed: %s", err))
+		default:
+			report.Latency = latency
+		}
+
+		if !opts.NoDownload && !opts.Control.isAborted() {
+			report.Download, err = runTransferPhase(ctx, opts, PhaseDownload, &s, rec, func(ctx context.Context, s api.Server, ctl *api.TransferControl, progress func(api.Progress)) (*api.TransferResult, error) {
+				return runDownloadTest(ctx, s, ctl, opts.Duration, opts.ChunkSize, progress)
+			})
+			if err != nil {
+				return report, err
+			}
+		}
+
+		if !opts.NoUpload && !opts.Control.isAborted() {
+			report.Upload, err = runTransferPhase(ctx, opts, PhaseUpload, &s, rec, func(ctx context.Context, s api.Server, ctl *api.TransferControl, progress func(api.Progress)) (*api.TransferResult, error) {
+				return runUploadTest(ctx, s, ctl, opts.Duration, opts.UploadSize, progress)
+			})
+			if err != nil {
+				return report, err
+			}
+		}
+
+		if opts.Control.isAborted() {
+			report.Server = s
+			return report, ErrAborted
+		}
+
+		// The urls of the server are replaced when they expire during a transfer.
+		report.Server = s
+
+		// Test only the first server for right now. Intention is to test nearest 3 at the same time and record the results.
+		if true {
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// runTransferPhase runs the named transfer phase against the server, passing its progress to the
+// observer. When the signed urls of the server expire during the phase, fresh ones are fetched and
+// the phase is run again, up to the number of retries. The server is updated with the fresh urls.
+// The transfer is resized and stopped through the control of the options.
+func runTransferPhase(ctx context.Context, opts *Options, name string, s *api.Server, rec *phaseRecorder, fn func(ctx context.Context, s api.Server, ctl *api.TransferControl, progress func(p api.Progress)) (*api.TransferResult, error)) (*api.TransferResult, error) {
+	for attempt := 0; ; attempt++ {
+		var result *api.TransferResult
+		server := *s
+		err := rec.track(ctx, name, phaseTimeout(name, opts), func(ctx context.Context) error {
+			start := time.Now()
+			progress := func(p api.Progress) {
+				rec.sample(name, Sample{Elapsed: time.Since(start), Bytes: p.Bytes, Connections: p.Connections})
+			}
+
+			var loaded *api.Samples
+			var wg sync.WaitGroup
+
+			loadCtx, stop := context.WithCancel(ctx)
+			defer stop()
+
+			if opts.LoadedLatency {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					loaded = sampleLoadedLatency(loadCtx, server, func(s Sample) {
+						s.Elapsed = time.Since(start)
+						rec.sample(name, s)
+					})
+				}()
+			}
+
+			ctl, release := opts.Control.newTransfer(opts.Connections)
+			defer release()
+
+			r, err := fn(ctx, server, ctl, progress)
+			stop()
+			wg.Wait()
+
+			if err != nil {
+				return err
+			}
+
+			if loaded != nil && len(loaded.RTTs) > 0 {
+				r.LoadedLatency = loaded.Latency()
+			}
+
+			result = r
+			return nil
+		})
+		if err == nil {
+			for _, e := range result.Errors {
+				rec.warn(logger.With(ctx, logger.KeyPhase, name), fmt.Sprintf("%s: %s", name, e))
+			}
+
+			return result, nil
+		}
+
+		if !errors.Is(err, api.ErrURLExpired) || attempt >= opts.Retries {
+			return nil, err
+		}
+
+		logger.FromContext(ctx).Warn("the urls expired; fetching new ones", logger.KeyPhase, name)
+		rec.retried()
+
+		if err := refreshServer(ctx, opts, s, rec); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// refreshServer replaces the server with its entry in a newly fetched server list, which carries
+// freshly signed urls. The nearest server in the list is used when it is no longer listed.
+func refreshServer(ctx context.Context, opts *Options, s *api.Server, rec *phaseRecorder) error {
+	if opts.ServersFile != "" {
+		return fmt.Errorf("%w: update the urls in %s", api.ErrURLExpired, opts.ServersFile)
+	}
+
+	if err := cache.New(opts.CacheFile).DropServerList(); err != nil {
+		logger.FromContext(ctx).Warn("failed to drop the cached server list", "error", err)
+	}
+
+	remote, err := getRemoteServerList(ctx, opts, rec)
+	if err != nil {
+		return err
+	}
+
+	if len(remote.Targets) == 0 {
+		return ErrNoCandidatesToRank
+	}
+
+	for _, t := range remote.Targets {
+		if t.Name == s.Name {
+			*s = t
+			return nil
+		}
+	}
+
+	logger.FromContext(ctx).Warn("the server is no longer listed; testing against the nearest instead", "replacement", remote.Targets[0].Name)
+	*s = remote.Targets[0]
+
+	return nil
+}
+
+// runDownloadTest performs the download speed test that measures the download rate.
+func runDownloadTest(ctx context.Context, server api.Server, ctl *api.TransferControl, duration time.Duration, chunk int64, progress func(p api.Progress)) (*api.TransferResult, error) {
+	err := server.SetChunkSize(chunk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append chunk size: %s", err)
+	}
+
+	return server.Download(ctx, ctl, duration, progress)
+}
+
+// runUploadTest performs the upload speed test that generates a payload to send to the server
+// and measures its upload rate.
+func runUploadTest(ctx context.Context, server api.Server, ctl *api.TransferControl, duration time.Duration, size int, progress func(p api.Progress)) (*api.TransferResult, error) {
+	payload, err := api.GeneratePayload(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return server.Upload(ctx, ctl, duration, payload, progress)
+}
+
+// The probe that measures the loaded latency and how often, replaced in tests.
+var (
+	loadedProbe           = api.TCPProbe
+	loadedLatencyInterval = LoadedLatencyInterval
+)
+
+// sampleLoadedLatency measures the round-trip time to the server every loadedLatencyInterval until
+// the context ends, passing each to sample, and returns them.
+func sampleLoadedLatency(ctx context.Context, server api.Server, sample func(s Sample)) *api.Samples {
+	samples := &api.Samples{Method: loadedProbe.Method()}
+
+	ticker := time.NewTicker(loadedLatencyInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return samples
+		case <-ticker.C:
+		}
+
+		set, err := loadedProbe.Probe(ctx, server, 1)
+		if ctx.Err() != nil {
+			return samples
+		}
+
+		if err != nil || len(set.RTTs) == 0 {
+			samples.Lost++
+			sample(Sample{Method: samples.Method, Lost: true})
+			continue
+		}
+
+		samples.RTTs = append(samples.RTTs, set.RTTs[0])
+		sample(Sample{RTT: set.RTTs[0], Method: samples.Method})
+	}
+}
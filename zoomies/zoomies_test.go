@@ -0,0 +1,399 @@
+package zoomies
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/primlock/zoomies/api"
+	"github.com/primlock/zoomies/internal/logger"
+	"gotest.tools/v3/assert"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		modify   func(o *Options)
+		expected error
+	}{
+		{name: "Defaults are valid", modify: func(o *Options) {}},
+		{name: "Duration below the lower boundary", modify: func(o *Options) { o.Duration = 2 * time.Second }, expected: ErrDurationOutOfBounds},
+		{name: "Pings above the upper boundary", modify: func(o *Options) { o.Pings = 6 }, expected: ErrPingCountOutOfBounds},
+		{name: "Timeout below the lower boundary", modify: func(o *Options) { o.Timeout = 0 }, expected: ErrTimeoutOutOfBounds},
+		{name: "Timeout shorter than the transfers", modify: func(o *Options) { o.Duration, o.Timeout = 30*time.Second, 60*time.Second }, expected: ErrTimeoutTooShort},
+		{name: "Timeout long enough for one transfer", modify: func(o *Options) { o.Duration, o.Timeout, o.NoUpload = 30*time.Second, 60*time.Second, true }},
+		{name: "Connections above the upper boundary", modify: func(o *Options) { o.Connections = 64 }, expected: ErrConnectionsOutOfBounds},
+		{name: "Record with a servers file", modify: func(o *Options) { o.Record, o.ServersFile = "a.json", "b.json" }, expected: ErrRecordWithServersFile},
+		{name: "Unknown rank", modify: func(o *Options) { o.Selection.Rank = "fastest" }, expected: ErrUnknownRankStrategy},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(&opts)
+
+			err := opts.Validate()
+			if tt.expected == nil {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	servers := filepath.Join(t.TempDir(), "servers.txt")
+	assert.NilError(t, os.WriteFile(servers, []byte(srv.URL+"\n"), 0o644))
+
+	errProbe := errors.New("probe failed")
+
+	testCases := []struct {
+		name     string
+		probe    func(ctx context.Context, server api.Server, count int) (*api.Samples, error)
+		latency  bool
+		warnings int
+		events   []string
+	}{
+		{name: "Latency measured with the prober", probe: func(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+			return &api.Samples{RTTs: []time.Duration{10 * time.Millisecond, 30 * time.Millisecond}, Lost: 1}, nil
+		}, latency: true, events: []string{
+			"start server_list", "end server_list", "start candidate_probing", "end candidate_probing",
+			"start latency " + srv.URL, "sample latency 10ms", "sample latency 30ms", "sample latency lost", "end latency",
+		}},
+		{name: "Failed latency test is a warning", probe: func(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+			return nil, errProbe
+		}, warnings: 1, events: []string{
+			"start server_list", "end server_list", "start candidate_probing", "end candidate_probing",
+			"start latency " + srv.URL, "end latency probe failed", "warning latency test failed: probe failed",
+		}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.CacheFile = ""
+			opts.ServersFile = servers
+			opts.NoDownload = true
+			opts.NoUpload = true
+			opts.Prober = api.NewProber("mock", tt.probe)
+
+			obs := &recordingObserver{}
+			opts.Observer = obs
+
+			report, err := Run(context.Background(), opts)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, obs.events, tt.events)
+
+			assert.Equal(t, report.Server.URL, srv.URL)
+			assert.Equal(t, len(report.Warnings), tt.warnings)
+			assert.Equal(t, report.Latency != nil, tt.latency)
+			if tt.latency {
+				assert.Equal(t, report.Latency.Ping, 20*time.Millisecond)
+				assert.Equal(t, report.Latency.Method, "mock")
+			}
+
+			names := make([]string, len(report.Phases))
+			for i, p := range report.Phases {
+				names[i] = p.Name
+			}
+			assert.DeepEqual(t, names, []string{PhaseServerList, PhaseCandidateProbing, PhaseLatency})
+		})
+	}
+}
+
+func TestRunLogs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	servers := filepath.Join(t.TempDir(), "servers.txt")
+	assert.NilError(t, os.WriteFile(servers, []byte(srv.URL+"\n"), 0o644))
+
+	var b bytes.Buffer
+	l, err := logger.New(&b, logger.FormatJSON, "debug")
+	assert.NilError(t, err)
+
+	opts := DefaultOptions()
+	opts.CacheFile = ""
+	opts.ServersFile = servers
+	opts.NoDownload = true
+	opts.NoUpload = true
+	opts.Logger = l
+	opts.Prober = api.NewProber("mock", func(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+		return &api.Samples{RTTs: []time.Duration{10 * time.Millisecond}}, nil
+	})
+
+	_, err = Run(context.Background(), opts)
+	assert.NilError(t, err)
+
+	var records []map[string]any
+	dec := json.NewDecoder(&b)
+	for dec.More() {
+		var r map[string]any
+		assert.NilError(t, dec.Decode(&r))
+		records = append(records, r)
+	}
+	assert.Assert(t, len(records) > 0)
+
+	// Every record of the run carries its request id, and those of the phases their name.
+	phases := map[any]any{}
+	for _, r := range records {
+		assert.Equal(t, r[logger.KeyRequestID], records[0][logger.KeyRequestID])
+		if r["msg"] == "phase finished" {
+			phases[r[logger.KeyPhase]] = r[logger.KeyServer]
+		}
+	}
+
+	u, err := url.Parse(srv.URL)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, phases, map[any]any{PhaseServerList: nil, PhaseCandidateProbing: nil, PhaseLatency: u.Hostname()})
+}
+
+func TestControl(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Write(make([]byte, 1024))
+	}))
+	t.Cleanup(srv.Close)
+
+	servers := filepath.Join(t.TempDir(), "servers.txt")
+	assert.NilError(t, os.WriteFile(servers, []byte(srv.URL+"\n"), 0o644))
+
+	testCases := []struct {
+		name     string
+		phase    string
+		control  func(c *Control)
+		expected error
+		download bool
+		warnings []string
+	}{
+		{name: "Latency test skipped", phase: PhaseLatency, control: (*Control).Skip, warnings: []string{"latency test was skipped"}},
+		{name: "Download test skipped", phase: PhaseDownload, control: (*Control).Skip, download: true},
+		{name: "Aborted during the download test", phase: PhaseDownload, control: (*Control).Abort, expected: ErrAborted, download: true},
+		{name: "Aborted during the latency test", phase: PhaseLatency, control: (*Control).Abort, expected: ErrAborted},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.CacheFile = ""
+			opts.ServersFile = servers
+			opts.NoDownload = !tt.download
+			opts.NoUpload = true
+			opts.Control = NewControl()
+			opts.Observer = &controlObserver{phase: tt.phase, fn: func() { tt.control(opts.Control) }}
+
+			// The latency test runs until it is skipped or aborted.
+			opts.Prober = api.NewProber("mock", func(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(100 * time.Millisecond):
+					return &api.Samples{RTTs: []time.Duration{time.Millisecond}}, nil
+				}
+			})
+
+			start := time.Now()
+			report, err := Run(context.Background(), opts)
+			if tt.expected != nil {
+				assert.ErrorIs(t, err, tt.expected)
+			} else {
+				assert.NilError(t, err)
+			}
+
+			// The tests are cut short.
+			assert.Assert(t, time.Since(start) < opts.Duration)
+
+			assert.Equal(t, report.Download != nil, tt.download)
+			assert.Assert(t, report.Upload == nil)
+			assert.DeepEqual(t, report.Warnings, tt.warnings)
+		})
+	}
+}
+
+func TestControlConnections(t *testing.T) {
+	c := NewControl()
+	c.start(2, func(error) {})
+
+	c.RemoveConnection()
+	c.RemoveConnection()
+	assert.Equal(t, c.Connections(), 1)
+
+	ctl, release := c.newTransfer(DefaultConnections)
+	defer release()
+
+	for i := 0; i < MaxConnections+1; i++ {
+		c.AddConnection()
+	}
+	assert.Equal(t, c.Connections(), MaxConnections)
+	assert.Equal(t, ctl.Requests(), MaxConnections)
+}
+
+// controlObserver calls fn shortly after the phase starts, once the phase can be controlled.
+type controlObserver struct {
+	nopObserver
+	phase string
+	fn    func()
+}
+
+func (o *controlObserver) OnPhaseStart(phase string, target *Target) {
+	if phase == o.phase {
+		time.AfterFunc(30*time.Millisecond, o.fn)
+	}
+}
+
+// recordingObserver describes each call made to it so that tests can check the progress of a run.
+type recordingObserver struct {
+	events []string
+}
+
+func (o *recordingObserver) OnPhaseStart(phase string, target *Target) {
+	if target != nil {
+		o.events = append(o.events, fmt.Sprintf("start %s %s", phase, target.Server.URL))
+		return
+	}
+
+	o.events = append(o.events, "start "+phase)
+}
+
+func (o *recordingObserver) OnSample(phase string, sample Sample) {
+	switch {
+	case sample.Lost:
+		o.events = append(o.events, fmt.Sprintf("sample %s lost", phase))
+	case sample.RTT > 0:
+		o.events = append(o.events, fmt.Sprintf("sample %s %s", phase, sample.RTT))
+	default:
+		o.events = append(o.events, fmt.Sprintf("sample %s %d", phase, sample.Bytes))
+	}
+}
+
+func (o *recordingObserver) OnPhaseEnd(phase string, err error) {
+	if err != nil {
+		o.events = append(o.events, fmt.Sprintf("end %s %s", phase, err))
+		return
+	}
+
+	o.events = append(o.events, "end "+phase)
+}
+
+func (o *recordingObserver) OnWarning(msg string) {
+	o.events = append(o.events, "warning "+msg)
+}
+
+func TestObserverTransferProgress(t *testing.T) {
+	obs := &recordingObserver{}
+	rec := newPhaseRecorder(obs)
+
+	var late func(api.Progress)
+	s := api.Server{Name: "server1"}
+	_, err := runTransferPhase(context.Background(), &Options{}, PhaseUpload, &s, rec, func(ctx context.Context, s api.Server, ctl *api.TransferControl, progress func(api.Progress)) (*api.TransferResult, error) {
+		progress(api.Progress{Bytes: 100})
+		progress(api.Progress{Bytes: 250})
+		late = progress
+		return &api.TransferResult{Bytes: 250, Errors: []string{"connection reset"}}, nil
+	})
+	assert.NilError(t, err)
+
+	// A phase that has ended reports no more samples.
+	late(api.Progress{Bytes: 500})
+
+	assert.DeepEqual(t, obs.events, []string{"start upload", "sample upload 100", "sample upload 250", "end upload", "warning upload: connection reset"})
+}
+
+func TestLoadedLatency(t *testing.T) {
+	loadedProbe = api.NewProber(api.ProbeTCP, func(ctx context.Context, server api.Server, count int) (*api.Samples, error) {
+		return &api.Samples{RTTs: []time.Duration{40 * time.Millisecond}}, nil
+	})
+	loadedLatencyInterval = 10 * time.Millisecond
+	t.Cleanup(func() { loadedProbe, loadedLatencyInterval = api.TCPProbe, LoadedLatencyInterval })
+
+	obs := &recordingObserver{}
+	rec := newPhaseRecorder(obs)
+
+	s := api.Server{Name: "server1"}
+	got, err := runTransferPhase(context.Background(), &Options{LoadedLatency: true}, PhaseDownload, &s, rec, func(ctx context.Context, s api.Server, ctl *api.TransferControl, progress func(api.Progress)) (*api.TransferResult, error) {
+		time.Sleep(100 * time.Millisecond)
+		return &api.TransferResult{Bytes: 1}, nil
+	})
+	assert.NilError(t, err)
+
+	assert.Assert(t, got.LoadedLatency != nil)
+	assert.Equal(t, got.LoadedLatency.Ping, 40*time.Millisecond)
+	assert.Equal(t, got.LoadedLatency.Method, api.ProbeTCP)
+	assert.Assert(t, len(obs.events) > 2)
+	assert.Equal(t, obs.events[1], "sample download 40ms")
+}
+
+func TestRunTransferPhaseRefresh(t *testing.T) {
+	const list = `{"targets":[{"name":"server2","url":"https://b/fresh"},{"name":"server1","url":"https://a/fresh"}]}`
+
+	testCases := []struct {
+		name     string
+		retries  int
+		expired  int
+		url      string
+		expected error
+	}{
+		{name: "Transfer without expiry", retries: 3, url: "https://a/stale"},
+		{name: "Expired urls refreshed", retries: 3, expired: 1, url: "https://a/fresh"},
+		{name: "Urls keep expiring", retries: 1, expired: 5, expected: api.ErrURLExpired},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Token = "token"
+			opts.Retries = tt.retries
+
+			fetchServerList = func(ctx context.Context, token string) ([]byte, error) {
+				return []byte(list), nil
+			}
+			t.Cleanup(func() { fetchServerList = requestServerList })
+
+			var logs bytes.Buffer
+			l, err := logger.New(&logs, logger.FormatJSON, "debug")
+			assert.NilError(t, err)
+
+			calls := 0
+			s := api.Server{Name: "server1", URL: "https://a/stale"}
+			rec := &phaseRecorder{}
+			ctx := logger.With(logger.NewContext(context.Background(), l), logger.KeyServer, s.Name)
+
+			got, err := runTransferPhase(ctx, &opts, PhaseDownload, &s, rec, func(ctx context.Context, s api.Server, ctl *api.TransferControl, progress func(api.Progress)) (*api.TransferResult, error) {
+				calls++
+				if calls <= tt.expired {
+					return nil, api.ErrURLExpired
+				}
+				return &api.TransferResult{Bytes: 1}, nil
+			})
+
+			// The server is carried by the context logger and must not be repeated in a record.
+			for _, line := range strings.FieldsFunc(logs.String(), func(r rune) bool { return r == '\n' }) {
+				assert.Equal(t, strings.Count(line, `"`+logger.KeyServer+`":`), 1, line)
+			}
+
+			if tt.expected != nil {
+				assert.ErrorIs(t, err, tt.expected)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, got.Bytes, uint64(1))
+			assert.Equal(t, s.URL, tt.url)
+			assert.Equal(t, rec.retryCount(), tt.expired)
+		})
+	}
+}